@@ -0,0 +1,256 @@
+package fixrupr
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// TB is the part of testing.TB the assertions use. *testing.T and *testing.B satisfy it.
+type TB interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+	Name() string
+}
+
+// AssertOption configures AssertTable.
+type AssertOption func(*assertOptions)
+
+type assertOptions struct {
+	ignore    map[string]bool
+	unordered bool
+	orderBy   []string
+}
+
+// IgnoreColumns leaves columns out of the comparison - for things like auto-updated timestamps. Ignored
+// columns are also left out of snapshots.
+func IgnoreColumns(columns ...string) AssertOption {
+	return func(o *assertOptions) {
+		for _, column := range columns {
+			o.ignore[column] = true
+		}
+	}
+}
+
+// Unordered matches rows regardless of order. By default, the first expected row is compared with the
+// first row in the table, and so on.
+func Unordered() AssertOption {
+	return func(o *assertOptions) {
+		o.unordered = true
+	}
+}
+
+// OrderBy sorts the table's rows by columns before comparing them. Without it, the rows are compared in
+// whatever order the database returns them - usually primary key order.
+func OrderBy(columns ...string) AssertOption {
+	return func(o *assertOptions) {
+		o.orderBy = columns
+	}
+}
+
+// AssertTable compares the rows in a table with the rows in an expected file, and fails the test with a
+// row-level diff if they don't match. Returns true if they match.
+//
+// The expected file uses the same format as data files, plus two matchers: {any: true} matches any value
+// (including NULL), and {regex: "..."} matches non-NULL values the regular expression matches. Columns
+// an expected row leaves out must be NULL. Values are compared as the text mysql returns, so quote
+// values like "1.50" that yaml would otherwise rewrite. Relative time cells are evaluated against the
+// time SetUp (or Reset) ran.
+//
+// t: the test
+// table: the logical table name - "<schema>.<table>"
+// expectedFile: path to the expected file, relative to the config directory
+// opts (optional): IgnoreColumns, Unordered, OrderBy
+func (f *Fixr) AssertTable(t TB, table string, expectedFile string, opts ...AssertOption) bool {
+	t.Helper()
+
+	options := &assertOptions{ignore: map[string]bool{}}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	file := expectedFile
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(f.path, file)
+	}
+
+	conf := &fixrConf{path: f.path, vars: f.vars}
+	expected, err := conf.loadRows(file)
+	if err != nil {
+		t.Errorf("fixrupr: %s: %s", table, err)
+		return false
+	}
+
+	actual, err := f.selectRows(table, options.orderBy)
+	if err != nil {
+		t.Errorf("fixrupr: %s: %s", table, err)
+		return false
+	}
+
+	diff := f.diffRows(expected, actual, options)
+	if diff != "" {
+		t.Errorf("fixrupr: %s does not match %s\n%s", table, expectedFile, diff)
+		return false
+	}
+	return true
+}
+
+// compares expected rows with the rows from a table. returns a readable description of the differences,
+// or an empty string if there aren't any.
+func (f *Fixr) diffRows(expected []map[string]fixrCellDef, actual *fixrTableRows, options *assertOptions) string {
+	diff := &bytes.Buffer{}
+
+	columns := []int{}
+	known := map[string]bool{}
+	for i, column := range actual.columns {
+		known[column] = true
+		if !options.ignore[column] {
+			columns = append(columns, i)
+		}
+	}
+
+	// expected rows keyed by column rather than by field
+	expectedRows := []map[string]fixrCellDef{}
+	for i, row := range expected {
+		expectedRow := map[string]fixrCellDef{}
+		for field, cellDef := range row {
+			column := field
+			if cellDef.column != "" {
+				column = cellDef.column
+			}
+			if !known[column] {
+				fmt.Fprintf(diff, "  expected row %d: unknown column %s\n", i+1, column)
+			}
+			expectedRow[column] = cellDef
+		}
+		expectedRows = append(expectedRows, expectedRow)
+	}
+	if diff.Len() > 0 {
+		return diff.String()
+	}
+
+	// describes what doesn't match in a pair of rows
+	mismatches := func(expectedRow map[string]fixrCellDef, actualRow [][]byte) (problems []string) {
+		for _, i := range columns {
+			column := actual.columns[i]
+			expectedValue, matches := f.matchCell(expectedRow[column], actualRow[i])
+			if !matches {
+				problems = append(problems, fmt.Sprintf("%s: expected %s, got %s", column, expectedValue, formatValue(actualRow[i])))
+			}
+		}
+		return
+	}
+
+	if options.unordered {
+		// a row with {any: true} or a regex can match several rows, so taking the first match for each
+		// expected row can leave a more specific one without a match. pairing the rows up is a bipartite
+		// matching - each expected row looks for a free row, or one whose expected row can move elsewhere.
+		candidates := make([][]int, len(expectedRows))
+		for i, expectedRow := range expectedRows {
+			for j, actualRow := range actual.rows {
+				if len(mismatches(expectedRow, actualRow)) == 0 {
+					candidates[i] = append(candidates[i], j)
+				}
+			}
+		}
+
+		// the expected row each row is matched with, or -1
+		matchedTo := make([]int, len(actual.rows))
+		for j := range matchedTo {
+			matchedTo[j] = -1
+		}
+		var match func(i int, visited []bool) bool
+		match = func(i int, visited []bool) bool {
+			for _, j := range candidates[i] {
+				if visited[j] {
+					continue
+				}
+				visited[j] = true
+				if matchedTo[j] < 0 || match(matchedTo[j], visited) {
+					matchedTo[j] = i
+					return true
+				}
+			}
+			return false
+		}
+
+		for i, expectedRow := range expectedRows {
+			if !match(i, make([]bool, len(actual.rows))) {
+				fmt.Fprintf(diff, "  expected row %d is missing\n    - %s\n", i+1, f.formatExpectedRow(expectedRow, actual.columns, columns))
+			}
+		}
+		for j, actualRow := range actual.rows {
+			if matchedTo[j] < 0 {
+				fmt.Fprintf(diff, "  unexpected row\n    + %s\n", formatRow(actualRow, actual.columns, columns))
+			}
+		}
+		return diff.String()
+	}
+
+	for i := 0; i < len(expectedRows) || i < len(actual.rows); i++ {
+		switch {
+		case i >= len(actual.rows):
+			fmt.Fprintf(diff, "  row %d is missing\n    - %s\n", i+1, f.formatExpectedRow(expectedRows[i], actual.columns, columns))
+		case i >= len(expectedRows):
+			fmt.Fprintf(diff, "  row %d is unexpected\n    + %s\n", i+1, formatRow(actual.rows[i], actual.columns, columns))
+		default:
+			problems := mismatches(expectedRows[i], actual.rows[i])
+			if len(problems) > 0 {
+				fmt.Fprintf(diff, "  row %d is different\n    - %s\n    + %s\n", i+1, f.formatExpectedRow(expectedRows[i], actual.columns, columns), formatRow(actual.rows[i], actual.columns, columns))
+				for _, problem := range problems {
+					fmt.Fprintf(diff, "      %s\n", problem)
+				}
+			}
+		}
+	}
+
+	return diff.String()
+}
+
+// checks a value from the database against an expected cell. returns a description of the expected value.
+func (f *Fixr) matchCell(cellDef fixrCellDef, actual []byte) (expected string, matches bool) {
+	switch {
+	case cellDef.any:
+		return "anything", true
+	case !cellDef.notNil:
+		return "NULL", actual == nil
+	case cellDef.pattern != nil:
+		return fmt.Sprintf("/%s/", cellDef.pattern), actual != nil && cellDef.pattern.Match(actual)
+	case cellDef.isTime:
+		t, err := relativeTime(cellDef.timeExpr, f.now)
+		if err != nil {
+			return err.Error(), false
+		}
+		value := []byte(t.Format(cellDef.timeFormat))
+		return formatValue(value), bytes.Equal(value, actual)
+	case cellDef.isBinary:
+		return formatValue(cellDef.binary), actual != nil && bytes.Equal(cellDef.binary, actual)
+	default:
+		return formatValue([]byte(cellDef.value)), actual != nil && cellDef.value == string(actual)
+	}
+}
+
+func (f *Fixr) formatExpectedRow(row map[string]fixrCellDef, names []string, columns []int) string {
+	values := []string{}
+	for _, i := range columns {
+		expected, _ := f.matchCell(row[names[i]], nil)
+		values = append(values, fmt.Sprintf("%s: %s", names[i], expected))
+	}
+	return fmt.Sprintf("{%s}", strings.Join(values, ", "))
+}
+
+func formatRow(row [][]byte, names []string, columns []int) string {
+	values := []string{}
+	for _, i := range columns {
+		values = append(values, fmt.Sprintf("%s: %s", names[i], formatValue(row[i])))
+	}
+	return fmt.Sprintf("{%s}", strings.Join(values, ", "))
+}
+
+func formatValue(value []byte) string {
+	if value == nil {
+		return "NULL"
+	}
+	return fmt.Sprintf("%q", value)
+}
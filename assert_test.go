@@ -0,0 +1,149 @@
+package fixrupr
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type mockTB struct {
+	name   string
+	errors []string
+}
+
+func (t *mockTB) Helper() {}
+
+func (t *mockTB) Name() string {
+	return t.name
+}
+
+func (t *mockTB) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func (s *MySuite) help_mockAssert(c *C, expected string) (*Fixr, *mockDb) {
+	dir := c.MkDir()
+	os.MkdirAll(fmt.Sprintf("%s/expected", dir), 0755)
+	ioutil.WriteFile(fmt.Sprintf("%s/expected/comments.yml", dir), []byte(expected), 0755)
+
+	conn := &mockDb{
+		columns: []string{"id", "comment", "posted"},
+		results: [][]driver.Value{
+			{[]byte("1"), []byte("cool!"), []byte("2015-03-15 12:30:00")},
+			{[]byte("2"), []byte("meh"), nil},
+		},
+	}
+	fixr := &Fixr{
+		conn:   conn,
+		prefix: "v_test",
+		path:   dir,
+		now:    time.Date(2015, 3, 15, 12, 30, 0, 0, time.UTC),
+	}
+	return fixr, conn
+}
+
+func (s *MySuite) Test_fixr_AssertTable(c *C) {
+	fixr, _ := s.help_mockAssert(c, `
+- id: 1
+  text:
+    column: comment
+    value: cool!
+  posted:
+    now: ""
+- id: 2
+  comment:
+    regex: "^m"
+`)
+
+	t := &mockTB{}
+	c.Check(fixr.AssertTable(t, "blog.comments", "expected/comments.yml"), Equals, true)
+	c.Check(t.errors, HasLen, 0)
+}
+
+func (s *MySuite) Test_fixr_AssertTable_different(c *C) {
+	fixr, _ := s.help_mockAssert(c, `
+- id: 1
+  comment: cool!
+  posted: "2015-03-15 12:30:00"
+- id: 2
+  comment: "nice"
+  posted:
+    any: true
+- id: 3
+`)
+
+	t := &mockTB{}
+	c.Check(fixr.AssertTable(t, "blog.comments", "expected/comments.yml"), Equals, false)
+	c.Assert(t.errors, HasLen, 1)
+	c.Check(t.errors[0], Equals, `fixrupr: blog.comments does not match expected/comments.yml
+  row 2 is different
+    - {id: "2", comment: "nice", posted: anything}
+    + {id: "2", comment: "meh", posted: NULL}
+      comment: expected "nice", got "meh"
+  row 3 is missing
+    - {id: "3", comment: NULL, posted: NULL}
+`)
+}
+
+func (s *MySuite) Test_fixr_AssertTable_options(c *C) {
+	fixr, conn := s.help_mockAssert(c, `
+- id: 2
+  comment: meh
+- id: 1
+  comment: cool!
+`)
+
+	t := &mockTB{}
+	c.Check(fixr.AssertTable(t, "blog.comments", "expected/comments.yml", Unordered(), IgnoreColumns("posted")), Equals, true)
+	c.Check(t.errors, HasLen, 0)
+
+	c.Check(fixr.AssertTable(t, "blog.comments", "expected/comments.yml", Unordered(), OrderBy("comment")), Equals, false)
+	c.Check(conn.queries[1], Equals, "select * from `v_test_blog`.`comments` order by `comment`")
+	c.Assert(t.errors, HasLen, 1)
+	c.Check(t.errors[0], Equals, `fixrupr: blog.comments does not match expected/comments.yml
+  expected row 2 is missing
+    - {id: "1", comment: "cool!", posted: NULL}
+  unexpected row
+    + {id: "1", comment: "cool!", posted: "2015-03-15 12:30:00"}
+`)
+}
+
+func (s *MySuite) Test_fixr_AssertTable_unorderedMatching(c *C) {
+	// the first expected row matches both rows - it mustn't take the only row the second one matches
+	fixr, _ := s.help_mockAssert(c, `
+- id:
+    any: true
+  comment:
+    any: true
+  posted:
+    any: true
+- id: 1
+  comment: cool!
+  posted: "2015-03-15 12:30:00"
+`)
+
+	t := &mockTB{}
+	c.Check(fixr.AssertTable(t, "blog.comments", "expected/comments.yml", Unordered()), Equals, true)
+	c.Check(t.errors, HasLen, 0)
+}
+
+func (s *MySuite) Test_fixr_AssertTable_errors(c *C) {
+	fixr, _ := s.help_mockAssert(c, `
+- id: 1
+  title: cool!
+`)
+
+	t := &mockTB{}
+	c.Check(fixr.AssertTable(t, "blog.comments", "expected/comments.yml"), Equals, false)
+	c.Check(fixr.AssertTable(t, "blog.comments", "expected/missing.yml"), Equals, false)
+	ioutil.WriteFile(fmt.Sprintf("%s/expected/invalid.yml", fixr.path), []byte("- id: [1"), 0755)
+	c.Check(fixr.AssertTable(t, "blog.comments", "expected/invalid.yml"), Equals, false)
+	c.Assert(t.errors, HasLen, 3)
+	c.Check(t.errors[0], Equals, "fixrupr: blog.comments does not match expected/comments.yml\n  expected row 1: unknown column title\n")
+	c.Check(t.errors[1], Matches, "fixrupr: blog.comments: open .*/expected/missing.yml: no such file or directory")
+	c.Check(t.errors[2], Matches, "fixrupr: blog.comments: .*/expected/invalid.yml: yaml: .*")
+}
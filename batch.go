@@ -0,0 +1,79 @@
+package fixrupr
+
+const (
+	// mysql's limit on the placeholders in a prepared statement
+	defaultMaxParams = 65535
+
+	// well under the smallest default max_allowed_packet (4MB), since the size is only an estimate
+	defaultMaxBytes = 1 << 20
+)
+
+// the rows in one insert - first is inclusive, last is exclusive
+type fixrBatch struct {
+	first int
+	last  int
+}
+
+// WithBatchLimits sets how big the inserts for a data file can get. Rows are split into as many inserts
+// as it takes to keep each one under maxParams placeholders and about maxBytes bytes (the query plus its
+// parameters), in the order they're listed. A row that's bigger than maxBytes on its own gets an insert
+// of its own. Zero means the default: 65535 placeholders (mysql's limit) and 1MB.
+func WithBatchLimits(maxParams int, maxBytes int) Option {
+	return func(f *Fixr) {
+		f.maxParams = maxParams
+		f.maxBytes = maxBytes
+	}
+}
+
+// splits rows into inserts that stay under the batch limits
+// headerSize: the size of the query before the values
+// rows: the values of each row - "(?,?,...)"
+// parameters: the parameters of each row
+func (f *Fixr) batch(headerSize int, rows []string, parameters [][]interface{}) (batches []fixrBatch) {
+	maxParams := f.maxParams
+	if maxParams <= 0 {
+		maxParams = defaultMaxParams
+	}
+	maxBytes := f.maxBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxBytes
+	}
+
+	current := fixrBatch{}
+	params := 0
+	size := headerSize
+	for i, row := range rows {
+		rowParams := len(parameters[i])
+		rowSize := len(row) + 1
+		for _, param := range parameters[i] {
+			rowSize += paramSize(param)
+		}
+
+		if current.last > current.first && (params+rowParams > maxParams || size+rowSize > maxBytes) {
+			batches = append(batches, current)
+			current = fixrBatch{first: i, last: i}
+			params = 0
+			size = headerSize
+		}
+
+		current.last = i + 1
+		params += rowParams
+		size += rowSize
+	}
+	batches = append(batches, current)
+	return
+}
+
+// estimates how many bytes a parameter takes up
+func paramSize(param interface{}) int {
+	switch p := param.(type) {
+	case string:
+		return len(p)
+	case []byte:
+		return len(p)
+	case nil:
+		return 4
+	default:
+		return 8
+	}
+}
@@ -0,0 +1,74 @@
+package fixrupr
+
+import (
+	"errors"
+	"fmt"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) mock_batchData(count int) fixrDataDef {
+	rows := []map[string]fixrCellDef{}
+	for i := 1; i <= count; i++ {
+		rows = append(rows, map[string]fixrCellDef{
+			"id":   {notNil: true, isParameter: true, value: fmt.Sprintf("%d", i)},
+			"name": {notNil: true, isParameter: true, value: "abcdefghij"},
+		})
+	}
+	return fixrDataDef{name: "blog.users", schema: "blog", table: "users", rows: rows}
+}
+
+func (s *MySuite) Test_fixr_load_batches(c *C) {
+	// 5 rows of 2 parameters, at most 4 parameters per insert
+	conn := &mockDb{}
+	fixr := &Fixr{conn: conn, prefix: "v_test", maxParams: 4}
+
+	err := fixr.load(fixr.prefix, s.mock_batchData(5))
+	c.Assert(err, IsNil)
+	c.Check(conn.queries, DeepEquals, []string{
+		"insert into `v_test_blog`.`users` (`id`,`name`) VALUES (?,?),(?,?)",
+		"insert into `v_test_blog`.`users` (`id`,`name`) VALUES (?,?),(?,?)",
+		"insert into `v_test_blog`.`users` (`id`,`name`) VALUES (?,?)",
+	})
+	c.Check(conn.args[0], DeepEquals, []interface{}{"1", "abcdefghij", "2", "abcdefghij"})
+	c.Check(conn.args[2], DeepEquals, []interface{}{"5", "abcdefghij"})
+
+	// the defaults fit everything in one insert
+	conn = &mockDb{}
+	fixr = &Fixr{conn: conn, prefix: "v_test"}
+	err = fixr.load(fixr.prefix, s.mock_batchData(5))
+	c.Assert(err, IsNil)
+	c.Check(conn.queries, HasLen, 1)
+	c.Check(conn.args[0], HasLen, 10)
+}
+
+func (s *MySuite) Test_fixr_batch_bytes(c *C) {
+	// each row is "(?,?)," plus 11 or 12 bytes of parameters
+	fixr := &Fixr{maxBytes: 50}
+	rows := []string{}
+	parameters := [][]interface{}{}
+	for i := 0; i < 12; i++ {
+		rows = append(rows, "(?,?)")
+		parameters = append(parameters, []interface{}{"1", "abcdefghij"})
+	}
+
+	c.Check(fixr.batch(10, rows, parameters), DeepEquals, []fixrBatch{{0, 2}, {2, 4}, {4, 6}, {6, 8}, {8, 10}, {10, 12}})
+
+	// a row that's too big on its own still gets inserted
+	fixr.maxBytes = 1
+	c.Check(fixr.batch(10, rows[0:2], parameters[0:2]), DeepEquals, []fixrBatch{{0, 1}, {1, 2}})
+}
+
+func (s *MySuite) Test_fixr_load_batchError(c *C) {
+	cause := errors.New("Error 1153: Got a packet bigger than 'max_allowed_packet' bytes")
+	conn := &mockDb{errs: map[int]error{1: cause}}
+	fixr := &Fixr{conn: conn, prefix: "v_test", maxParams: 4}
+
+	err := fixr.load(fixr.prefix, s.mock_batchData(5))
+	c.Check(err, ErrorMatches, "blog.users rows 3-4 \\(insert 2 of 3\\): Error 1153: .*")
+	c.Check(conn.queries, HasLen, 2)
+
+	var dbErr *dbError
+	c.Assert(errors.As(err, &dbErr), Equals, true)
+	c.Check(dbErr.parameters, DeepEquals, []interface{}{"3", "abcdefghij", "4", "abcdefghij"})
+}
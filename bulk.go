@@ -0,0 +1,195 @@
+package fixrupr
+
+import (
+	"bufio"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// mysql errors that mean the server doesn't allow load data local infile
+var infileDisabled = map[uint16]bool{
+	1148: true, // ER_NOT_ALLOWED_COMMAND
+	3948: true, // ER_CLIENT_LOCAL_FILES_DISABLED
+}
+
+// numbers the reader handlers, so concurrent loads don't share a name
+var infileReaders int64
+
+// WithBulkLoad makes SetUp load data files with "load data local infile" instead of inserts - much faster
+// for data files with lots of rows. The rows are streamed to the server through a go-sql-driver/mysql
+// reader handler, so nothing is written to disk.
+//
+// Data files fall back to inserts when the connection doesn't use the go-sql-driver/mysql driver, when
+// the server doesn't allow local infile (local_infile=OFF), and when they have cells with param: false,
+// since raw sql can't be loaded.
+func WithBulkLoad() Option {
+	return func(f *Fixr) {
+		f.bulkLoad = true
+	}
+}
+
+// checks whether a data file can be loaded with load data local infile
+func (f *Fixr) bulkLoadable(data fixrDataDef) bool {
+	if !f.bulkLoad || atomic.LoadInt32(&f.bulkUnsupported) != 0 {
+		return false
+	}
+
+	db, ok := f.conn.(interface{ Driver() driver.Driver })
+	if !ok {
+		return false
+	}
+	if _, ok = db.Driver().(*mysql.MySQLDriver); !ok {
+		return false
+	}
+
+	return !hasRawCells(data)
+}
+
+// loads a group of rows with load data local infile
+// fallback: true if the server doesn't allow it, and the rows should be inserted instead
+func (f *Fixr) loadInfile(prefix string, data fixrDataDef) (fallback bool, err error) {
+	fields := getInsertFields(data.rows)
+	now := f.now
+
+	name := fmt.Sprintf("fixrupr_%d", atomic.AddInt64(&infileReaders, 1))
+	mysql.RegisterReaderHandler(name, func() io.Reader {
+		r, w := io.Pipe()
+		go func() {
+			w.CloseWithError(writeInfile(w, fields, data.rows, now))
+		}()
+		return r
+	})
+	defer mysql.DeregisterReaderHandler(name)
+
+	query := fmt.Sprintf(
+		`load data local infile 'Reader::%s' into table `+"`%s_%s`.`%s`"+` character set binary fields terminated by '\t' escaped by '\\' lines terminated by '\n' (%s)`,
+		name,
+		prefix,
+		data.schema,
+		data.table,
+		strings.Join(fields, ","),
+	)
+
+	// warnings belong to the connection that ran the load
+	conn, release, err := f.session()
+	if err != nil {
+		return
+	}
+	defer release()
+
+	result, err := conn.Exec(query)
+	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && infileDisabled[mysqlErr.Number] {
+			fallback = true
+			err = nil
+			return
+		}
+		err = newDbError(err, query, []interface{}{})
+		return
+	}
+
+	// local infile is always ignore - rows with duplicate keys are skipped, and bad values are
+	// converted, with a warning instead of an error
+	problems, err := infileWarnings(conn)
+	if err != nil {
+		return
+	}
+	affected, e := result.RowsAffected()
+	if e == nil && affected != int64(len(data.rows)) {
+		problems = append([]string{fmt.Sprintf("loaded %d of %d rows", affected, len(data.rows))}, problems...)
+	}
+	if len(problems) > 0 {
+		err = newDbError(fmt.Errorf("load data into `%s_%s`.`%s`: %s", prefix, data.schema, data.table, strings.Join(problems, "; ")), query, []interface{}{})
+	}
+	return
+}
+
+// gets the warnings from the last statement on a connection
+func infileWarnings(conn fixrConn) (warnings []string, err error) {
+	query := "show warnings"
+	rows, err := conn.Query(query)
+	if err != nil {
+		err = newDbError(err, query, []interface{}{})
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			level, message string
+			code           int
+		)
+		err = rows.Scan(&level, &code, &message)
+		if err != nil {
+			err = newDbError(err, query, []interface{}{})
+			return
+		}
+		if level != "Note" {
+			warnings = append(warnings, fmt.Sprintf("%s %d: %s", level, code, message))
+		}
+	}
+	err = rows.Err()
+	if err != nil {
+		err = newDbError(err, query, []interface{}{})
+	}
+	return
+}
+
+// writes rows in load data's tab separated format
+func writeInfile(w io.Writer, fields []string, rows []map[string]fixrCellDef, now time.Time) (err error) {
+	buf := bufio.NewWriter(w)
+	for _, row := range rows {
+		_, params, e := generateInsert(fields, row, now)
+		if e != nil {
+			return e
+		}
+
+		for i, param := range params {
+			if i > 0 {
+				buf.WriteByte('\t')
+			}
+			writeInfileValue(buf, param)
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.Flush()
+}
+
+// writes a value, escaping the characters load data treats specially
+func writeInfileValue(buf *bufio.Writer, param interface{}) {
+	var value []byte
+	switch p := param.(type) {
+	case nil:
+		buf.WriteString(`\N`)
+		return
+	case []byte:
+		value = p
+	default:
+		value = []byte(fmt.Sprintf("%v", p))
+	}
+
+	for _, b := range value {
+		switch b {
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case 0:
+			buf.WriteString(`\0`)
+		default:
+			buf.WriteByte(b)
+		}
+	}
+}
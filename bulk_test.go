@@ -0,0 +1,113 @@
+package fixrupr
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	. "gopkg.in/check.v1"
+)
+
+// a mockDb that says it uses the mysql driver
+type mockMySQLDb struct {
+	*mockDb
+}
+
+func (m mockMySQLDb) Driver() driver.Driver {
+	return &mysql.MySQLDriver{}
+}
+
+func (s *MySuite) Test_fixr_bulkLoadable(c *C) {
+	data := fixrDataDef{schema: "blog", table: "users", rows: []map[string]fixrCellDef{
+		{"id": {notNil: true, isParameter: true, value: "1"}, "deleted": {}},
+	}}
+
+	fixr := &Fixr{conn: mockMySQLDb{&mockDb{}}, bulkLoad: true}
+	c.Check(fixr.bulkLoadable(data), Equals, true)
+
+	// not the mysql driver
+	fixr.conn = &mockDb{}
+	c.Check(fixr.bulkLoadable(data), Equals, false)
+
+	// not turned on
+	fixr = &Fixr{conn: mockMySQLDb{&mockDb{}}}
+	c.Check(fixr.bulkLoadable(data), Equals, false)
+
+	// raw sql
+	fixr.bulkLoad = true
+	data.rows[0]["joined"] = fixrCellDef{notNil: true, value: "now()"}
+	c.Check(fixr.bulkLoadable(data), Equals, false)
+}
+
+func (s *MySuite) Test_fixr_load_infile(c *C) {
+	conn := &mockDb{affected: map[int]int64{0: 2}}
+	fixr := &Fixr{conn: mockMySQLDb{conn}, prefix: "v_test", bulkLoad: true}
+
+	err := fixr.load(fixr.prefix, s.mock_batchData(2))
+	c.Assert(err, IsNil)
+	c.Assert(conn.queries, HasLen, 2)
+	c.Check(conn.queries[1], Equals, "show warnings")
+	c.Check(conn.queries[0], Matches, "load data local infile 'Reader::fixrupr_[0-9]+' into table `v_test_blog`.`users` character set binary "+
+		`fields terminated by '\\t' escaped by '\\\\' lines terminated by '\\n' \(`+"`id`,`name`"+`\)`)
+
+	// the server doesn't allow local infile - inserts from then on
+	conn = &mockDb{errs: map[int]error{0: &mysql.MySQLError{Number: 3948, Message: "Loading local data is disabled"}}}
+	fixr = &Fixr{conn: mockMySQLDb{conn}, prefix: "v_test", bulkLoad: true}
+
+	err = fixr.load(fixr.prefix, s.mock_batchData(2))
+	c.Assert(err, IsNil)
+	c.Check(fixr.bulkUnsupported, Equals, int32(1))
+	c.Assert(conn.queries, HasLen, 2)
+	c.Check(strings.HasPrefix(conn.queries[0], "load data"), Equals, true)
+	c.Check(conn.queries[1], Equals, "insert into `v_test_blog`.`users` (`id`,`name`) VALUES (?,?),(?,?)")
+
+	// local infile skips rows with duplicate keys, with a warning - that's an error here
+	conn = &mockDb{
+		affected: map[int]int64{0: 1},
+		columns:  []string{"Level", "Code", "Message"},
+		results:  [][]driver.Value{{[]byte("Warning"), int64(1062), []byte("Duplicate entry '1' for key 'PRIMARY'")}},
+	}
+	fixr = &Fixr{conn: mockMySQLDb{conn}, prefix: "v_test", bulkLoad: true}
+
+	err = fixr.load(fixr.prefix, s.mock_batchData(2))
+	c.Check(err, ErrorMatches, "load data into `v_test_blog`.`users`: loaded 1 of 2 rows; Warning 1062: Duplicate entry '1' for key 'PRIMARY'")
+	c.Check(conn.queries, HasLen, 2)
+
+	// and converts bad values instead of failing
+	conn = &mockDb{
+		affected: map[int]int64{0: 2},
+		columns:  []string{"Level", "Code", "Message"},
+		results: [][]driver.Value{
+			{[]byte("Note"), int64(1051), []byte("just a note")},
+			{[]byte("Warning"), int64(1265), []byte("Data truncated for column 'name' at row 2")},
+		},
+	}
+	fixr = &Fixr{conn: mockMySQLDb{conn}, prefix: "v_test", bulkLoad: true}
+
+	err = fixr.load(fixr.prefix, s.mock_batchData(2))
+	c.Check(err, ErrorMatches, "load data into `v_test_blog`.`users`: Warning 1265: Data truncated for column 'name' at row 2")
+}
+
+func (s *MySuite) Test_writeInfile(c *C) {
+	now := time.Date(2015, 3, 15, 12, 30, 0, 0, time.UTC)
+	rows := []map[string]fixrCellDef{
+		{"id": {notNil: true, isParameter: true, value: "1"}, "bio": {notNil: true, isParameter: true, value: "tab\there\nnew line \\ backslash"}},
+		{"id": {notNil: true, isParameter: true, value: "2"}, "avatar": {notNil: true, isBinary: true, binary: []byte{0, 'a', '\r'}}},
+		{"id": {notNil: true, isParameter: true, value: "3"}, "joined": {notNil: true, isTime: true, timeExpr: "-1d", timeFormat: defaultTimeFormat}},
+	}
+	fields := getInsertFields(rows)
+	c.Check(fields, DeepEquals, []string{"`avatar`", "`bio`", "`id`", "`joined`"})
+
+	buf := &bytes.Buffer{}
+	err := writeInfile(buf, fields, rows, now)
+	c.Assert(err, IsNil)
+
+	content, _ := ioutil.ReadAll(buf)
+	c.Check(string(content), Equals, `\N	tab\there\nnew line \\ backslash	1	\N
+\0a\r	\N	2	\N
+\N	\N	3	2015-03-14 12:30:00
+`)
+}
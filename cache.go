@@ -0,0 +1,168 @@
+package fixrupr
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+)
+
+// WithCache makes SetUp reuse schemas set up earlier with the same prefix - for a long-lived database
+// that's set up with WithPrefix. The hashes of the DDL and data are stored in the tracking table, and
+// SetUp compares them with the current fixture files:
+//
+//   - nothing changed: SetUp doesn't do anything
+//   - only data changed: the rows are deleted and inserted again
+//   - DDL changed: the schemas are dropped and set up again
+//
+// Relative time cells are evaluated when the data was last inserted. WithCache needs the tracking
+// schema (the schemaName passed to New), with the ddl_hash and data_hash columns.
+func WithCache() Option {
+	return func(f *Fixr) {
+		f.cache = true
+	}
+}
+
+// the hashes stored for a schema in the tracking table
+type fixrCachedHashes struct {
+	ddl  string
+	data string
+}
+
+// sets up the schemas, skipping whatever hasn't changed since they were last set up
+func (f *Fixr) setUpCached() (err error) {
+	def := f.activeDef()
+	ddlHash := def.ddlHash()
+	dataHash := def.dataHash()
+
+	cached, err := f.cachedHashes()
+	if err != nil {
+		return
+	}
+
+	ddlMatches := len(cached) == len(def.schemas)
+	dataMatches := ddlMatches
+	for _, schema := range def.schemas {
+		hashes, ok := cached[schema.name]
+		if !ok || hashes.ddl != ddlHash {
+			ddlMatches = false
+		}
+		if !ok || hashes.data != dataHash {
+			dataMatches = false
+		}
+	}
+
+	switch {
+	case ddlMatches && dataMatches:
+		return
+	case ddlMatches:
+		err = f.clear()
+		if err != nil {
+			return
+		}
+		err = f.insert()
+	default:
+		err = f.uncache(cached)
+		if err != nil {
+			return
+		}
+		err = f.build()
+	}
+	if err != nil {
+		return
+	}
+
+	err = f.storeHashes(ddlHash, dataHash)
+	return
+}
+
+// gets the hashes of the schemas that are set up with the prefix, keyed by schema name
+func (f *Fixr) cachedHashes() (cached map[string]fixrCachedHashes, err error) {
+	query := fmt.Sprintf("select name, ddl_hash, data_hash from `%s`.schemas where prefix = ? and dropped is null", f.schemaName)
+	args := []interface{}{f.prefix}
+
+	rows, err := f.conn.Query(query, args...)
+	if err != nil {
+		err = newDbError(err, query, args)
+		return
+	}
+	defer rows.Close()
+
+	cached = map[string]fixrCachedHashes{}
+	for rows.Next() {
+		var (
+			name     string
+			ddlHash  sql.NullString
+			dataHash sql.NullString
+		)
+		err = rows.Scan(&name, &ddlHash, &dataHash)
+		if err != nil {
+			err = newDbError(err, query, args)
+			return
+		}
+		cached[name] = fixrCachedHashes{ddl: ddlHash.String, data: dataHash.String}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		err = newDbError(err, query, args)
+	}
+	return
+}
+
+// drops the schemas that are set up with the prefix and forgets them, so they can be set up again
+// cached: the schemas that are set up
+func (f *Fixr) uncache(cached map[string]fixrCachedHashes) (err error) {
+	// the schemas being set up, plus any left from a set up with a different config
+	names := []string{}
+	known := map[string]bool{}
+	for _, schema := range f.activeDef().schemas {
+		names = append(names, schema.name)
+		known[schema.name] = true
+	}
+	for _, name := range sortedCacheNames(cached) {
+		if !known[name] {
+			names = append(names, name)
+		}
+	}
+
+	for _, name := range names {
+		query := fmt.Sprintf("drop schema if exists `%s_%s`", f.prefix, name)
+		_, err = f.conn.Exec(query)
+		if err != nil {
+			err = newDbError(err, query, []interface{}{})
+			return
+		}
+
+		// the tracking table only allows one row per name and prefix
+		query = fmt.Sprintf("delete from `%s`.schemas where name = ? and prefix = ?", f.schemaName)
+		_, err = f.conn.Exec(query, name, f.prefix)
+		if err != nil {
+			err = newDbError(err, query, []interface{}{name, f.prefix})
+			return
+		}
+	}
+	return
+}
+
+// stores the hashes of what was set up in the tracking table
+func (f *Fixr) storeHashes(ddlHash string, dataHash string) (err error) {
+	for _, schema := range f.activeDef().schemas {
+		query := fmt.Sprintf("update `%s`.schemas set ddl_hash = ?, data_hash = ? where name = ? and prefix = ? and dropped is null", f.schemaName)
+		args := []interface{}{ddlHash, dataHash, schema.name, f.prefix}
+		_, err = f.conn.Exec(query, args...)
+		if err != nil {
+			err = newDbError(err, query, args)
+			return
+		}
+	}
+	return
+}
+
+func sortedCacheNames(cached map[string]fixrCachedHashes) []string {
+	names := []string{}
+	for name := range cached {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,75 @@
+package fixrupr
+
+import (
+	"database/sql/driver"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) Test_fixr_setUpCached(c *C) {
+	def := s.mock_templateDef()
+	ddlHash := []byte(def.ddlHash())
+	dataHash := []byte(def.dataHash())
+	columns := []string{"name", "ddl_hash", "data_hash"}
+
+	// nothing changed
+	conn := &mockDb{columns: columns, results: [][]driver.Value{{[]byte("blog"), ddlHash, dataHash}}}
+	fixr := &Fixr{conn: conn, def: def, prefix: "dev", schemaName: "tracking", clock: s.mock_now, cache: true}
+
+	err := fixr.SetUp()
+	c.Assert(err, IsNil)
+	c.Assert(conn.queries, HasLen, 1)
+	c.Check(conn.queries[0], Equals, "select name, ddl_hash, data_hash from `tracking`.schemas where prefix = ? and dropped is null")
+	c.Check(conn.args[0], DeepEquals, []interface{}{"dev"})
+
+	// only data changed
+	conn = &mockDb{columns: columns, results: [][]driver.Value{{[]byte("blog"), ddlHash, []byte("stale")}}}
+	fixr.conn = conn
+
+	err = fixr.SetUp()
+	c.Assert(err, IsNil)
+	c.Assert(conn.queries, HasLen, 8)
+	c.Check(conn.queries[1:5], DeepEquals, []string{
+		"set foreign_key_checks = 0",
+		"truncate table `dev_blog`.`comments`",
+		"truncate table `dev_blog`.`users`",
+		"set foreign_key_checks = 1",
+	})
+	c.Check(conn.queries[5], Equals, "insert into `dev_blog`.`users` (`id`) VALUES (1)")
+	c.Check(conn.queries[7], Equals, "update `tracking`.schemas set ddl_hash = ?, data_hash = ? where name = ? and prefix = ? and dropped is null")
+	c.Check(conn.args[7], DeepEquals, []interface{}{string(ddlHash), string(dataHash), "blog", "dev"})
+
+	// ddl changed, and a schema from an older config is still around
+	conn = &mockDb{columns: columns, results: [][]driver.Value{
+		{[]byte("blog"), []byte("stale"), dataHash},
+		{[]byte("archive"), nil, nil},
+	}}
+	fixr.conn = conn
+
+	err = fixr.SetUp()
+	c.Assert(err, IsNil)
+	c.Assert(conn.queries, HasLen, 15)
+	c.Check(conn.queries[1], Equals, "drop schema if exists `dev_blog`")
+	c.Check(conn.queries[2], Equals, "delete from `tracking`.schemas where name = ? and prefix = ?")
+	c.Check(conn.args[2], DeepEquals, []interface{}{"blog", "dev"})
+	c.Check(conn.queries[3], Equals, "drop schema if exists `dev_archive`")
+	c.Check(conn.args[4], DeepEquals, []interface{}{"archive", "dev"})
+	c.Check(conn.queries[5], Equals, "insert into `tracking`.schemas (name, prefix, hostname) values (?, ?, ?)")
+	c.Check(conn.queries[6], Equals, "create schema `dev_blog`")
+	c.Check(conn.queries[14], Equals, "update `tracking`.schemas set ddl_hash = ?, data_hash = ? where name = ? and prefix = ? and dropped is null")
+
+	// nothing set up yet
+	conn = &mockDb{columns: columns}
+	fixr.conn = conn
+
+	err = fixr.SetUp()
+	c.Assert(err, IsNil)
+	c.Assert(conn.queries, HasLen, 13)
+	c.Check(conn.queries[1], Equals, "drop schema if exists `dev_blog`")
+}
+
+func (s *MySuite) Test_New_cache(c *C) {
+	configPath := s.help_mockFiles(c)
+	_, err := New(nil, configPath, "", WithCache())
+	c.Check(err, ErrorMatches, "WithCache needs a tracking schema")
+}
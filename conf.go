@@ -1,36 +1,75 @@
 package fixrupr
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
 	"strings"
+	"text/template"
+	"time"
 
+	"github.com/BurntSushi/toml"
 	"gopkg.in/yaml.v2"
 )
 
+// the config file names fixrupr looks for - exactly one of them must exist
+var configFiles = []string{"test.config.json", "test.config.yml", "test.config.yaml", "test.config.toml"}
+
 type fixrConf struct {
-	path    string
-	Schemas []struct {
+	path     string
+	file     string
+	vars     map[string]string
+	problems []string
+	Include  []string `json:"include"`
+	Schemas  []struct {
 		Name      string   `json:"name"`
 		Tables    []string `json:"tables"`
 		Functions []string `json:"functions"`
 	} `json:"schemas"`
-	Data []string `json:"data"`
+	Data     []string `json:"data"`
+	Profiles map[string]struct {
+		Schemas []string `json:"schemas"`
+		Data    []string `json:"data"`
+	} `json:"profiles"`
 }
 
 type fixrDef struct {
-	schemas []fixrSchemaDef
-	data    []fixrDataDef
+	schemas  []fixrSchemaDef
+	data     []fixrDataDef
+	profiles map[string]fixrProfileDef
+}
+
+type fixrProfileDef struct {
+	file    string
+	schemas []string
+	data    []string
 }
 
 type fixrSchemaDef struct {
 	name      string
-	tables    []string
-	functions []string
+	tables    []fixrDDLDef
+	functions []fixrDDLDef
+}
+
+type fixrDDLDef struct {
+	name string
+	file string
+	ddl  string
+	tmpl *template.Template
+
+	// the variables the template uses, looked up when the config is loaded
+	vars map[string]string
 }
 
 type fixrDataDef struct {
+	name   string
+	file   string
 	schema string
 	table  string
 	rows   []map[string]fixrCellDef
@@ -41,72 +80,417 @@ type fixrCellDef struct {
 	notNil      bool
 	value       string
 	column      string
+	isTime      bool
+	timeExpr    string
+	timeFormat  string
+	isBinary    bool
+	binary      []byte
+	file        string
+	isMatcher   bool
+	any         bool
+	pattern     *regexp.Regexp
 }
 
 func (c *fixrConf) load() (def *fixrDef, err error) {
+	dir, err := filepath.Abs(c.path)
+	if err != nil {
+		return
+	}
+
+	return c.loadIncludes(map[string]bool{dir: true}, []string{dir})
+}
+
+// loads the config and everything it includes. included configs come first, in the order they are
+// listed, so the including config can add tables and data on top of them.
+// loaded: config directories that have already been loaded - a config included twice is only loaded once
+// stack: config directories that are currently being loaded - for detecting include cycles
+func (c *fixrConf) loadIncludes(loaded map[string]bool, stack []string) (def *fixrDef, err error) {
+	def = &fixrDef{}
+
+	// unknown variables are reported by validate rather than when the queries run
+	c.expand()
+
+	problems := []string{}
+	for _, include := range c.Include {
+		path := include
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(c.path, include)
+		}
+
+		var dir string
+		dir, err = filepath.Abs(path)
+		if err != nil {
+			return
+		}
+
+		for i, d := range stack {
+			if d == dir {
+				err = fmt.Errorf("include cycle: %s -> %s", strings.Join(stack[i:], " -> "), dir)
+				return
+			}
+		}
+		if loaded[dir] {
+			continue
+		}
+		loaded[dir] = true
+
+		var (
+			filename   string
+			included   *fixrConf
+			includeDef *fixrDef
+		)
+
+		filename, err = findConfig(path)
+		if err != nil {
+			return
+		}
+
+		included, err = loadConfig(filename)
+		if err != nil {
+			return
+		}
+		included.path = path
+		included.vars = c.vars
+
+		includeDef, err = included.loadIncludes(loaded, append(stack, dir))
+		if err != nil {
+			return
+		}
+
+		problems = append(problems, def.merge(includeDef)...)
+	}
+
+	// a config with problems of its own might name files that aren't there, so its files aren't loaded -
+	// the profiles are checked against what it declares instead, so everything is reported at once
+	invalid := c.validate(def)
+	problems = append(problems, invalid...)
+
+	var own *fixrDef
+	if len(invalid) > 0 {
+		own = c.declared()
+	} else {
+		own, err = c.loadFiles()
+		if err != nil {
+			return
+		}
+	}
+
+	problems = append(problems, def.merge(own)...)
+	problems = append(problems, def.validateProfiles()...)
+	if len(problems) > 0 {
+		err = newConfError(c.file, problems)
+	}
+
+	return
+}
+
+// loads a table or function file
+func (c *fixrConf) loadDDL(name string, file string) (ddlDef fixrDDLDef, err error) {
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return
+	}
+	expanded, err := expandVars(string(contents), c.vars, file)
+	if err != nil {
+		return
+	}
+	tmpl, err := parseDDL(expanded, file)
+	if err != nil {
+		return
+	}
+
+	// unknown variables are reported here, like ${VAR}s, rather than when the ddl runs
+	vars := map[string]string{}
+	unknown := []string{}
+	for _, v := range ddlVars(tmpl) {
+		if value, ok := lookupVar(v, c.vars); ok {
+			vars[v] = value
+		} else {
+			unknown = append(unknown, v)
+		}
+	}
+	if len(unknown) > 0 {
+		err = fmt.Errorf("unknown variable(s) %s in %s", strings.Join(unknown, ", "), file)
+		return
+	}
+
+	ddlDef = fixrDDLDef{name: name, file: file, ddl: expanded, tmpl: tmpl, vars: vars}
+	return
+}
+
+// loads the ddl and data files listed in the config
+func (c *fixrConf) loadFiles() (def *fixrDef, err error) {
 	// make sure the files exist and then load the file content
 	def = &fixrDef{}
 
 	var (
-		schemaDef   fixrSchemaDef
-		tableDef    []byte
-		functionDef []byte
-		dataDef     fixrDataDef
-		rowsDef     []byte
+		schemaDef fixrSchemaDef
+		ddlDef    fixrDDLDef
+		dataDef   fixrDataDef
 	)
 
 	for _, schema := range c.Schemas {
 		schemaDef = fixrSchemaDef{name: schema.Name}
 		for _, table := range schema.Tables {
-			tableDef, err = ioutil.ReadFile(fmt.Sprintf("%s/schema/%s/tables/%s.sql", c.path, schema.Name, table))
+			ddlDef, err = c.loadDDL(table, fmt.Sprintf("%s/schema/%s/tables/%s.sql", c.path, schema.Name, table))
 			if err != nil {
 				return
 			}
-			schemaDef.tables = append(schemaDef.tables, string(tableDef))
+			schemaDef.tables = append(schemaDef.tables, ddlDef)
 		}
 
 		for _, function := range schema.Functions {
-			functionDef, err = ioutil.ReadFile(fmt.Sprintf("%s/schema/%s/functions/%s.sql", c.path, schema.Name, function))
+			ddlDef, err = c.loadDDL(function, fmt.Sprintf("%s/schema/%s/functions/%s.sql", c.path, schema.Name, function))
 			if err != nil {
 				return
 			}
-			schemaDef.functions = append(schemaDef.functions, string(functionDef))
+			schemaDef.functions = append(schemaDef.functions, ddlDef)
 		}
 
 		def.schemas = append(def.schemas, schemaDef)
 	}
 
 	for _, d := range c.Data {
-		rowsDef, err = ioutil.ReadFile(fmt.Sprintf("%s/data/%s.yml", c.path, d))
-		if err != nil {
-			return
+		file := fmt.Sprintf("%s/data/%s.yml", c.path, d)
+		if _, e := os.Stat(file); os.IsNotExist(e) {
+			csvFile := fmt.Sprintf("%s/data/%s.csv", c.path, d)
+			if _, e = os.Stat(csvFile); e == nil {
+				file = csvFile
+			}
 		}
 
 		pieces := strings.Split(d, ".")
 		dataDef = fixrDataDef{
+			name:   d,
+			file:   file,
 			schema: pieces[0],
 			table:  pieces[1],
 		}
 
-		err = yaml.Unmarshal(rowsDef, &dataDef.rows)
+		dataDef.rows, err = c.loadRows(file)
 		if err != nil {
-			// TODO: wrap in error struct with all the necessary data
-			fmt.Println("Error", d)
 			return
 		}
+
+		// matchers only make sense in expected files
+		for _, row := range dataDef.rows {
+			for field, cellDef := range row {
+				if cellDef.isMatcher {
+					err = fmt.Errorf("%s: %s: any and regex can only be used in expected files", file, field)
+					return
+				}
+			}
+		}
 		def.data = append(def.data, dataDef)
 	}
 
+	def.profiles = c.profileDefs()
+	return
+}
+
+// the schemas, data, and profiles the config declares, without loading any of their files
+func (c *fixrConf) declared() (def *fixrDef) {
+	def = &fixrDef{}
+	for _, schema := range c.Schemas {
+		def.schemas = append(def.schemas, fixrSchemaDef{name: schema.Name})
+	}
+
+	for _, d := range c.Data {
+		pieces := strings.Split(d, ".")
+		if len(pieces) < 2 {
+			continue
+		}
+		def.data = append(def.data, fixrDataDef{name: d, file: fmt.Sprintf("%s/data/%s.yml", c.path, d), schema: pieces[0], table: pieces[1]})
+	}
+
+	def.profiles = c.profileDefs()
+	return
+}
+
+func (c *fixrConf) profileDefs() (profiles map[string]fixrProfileDef) {
+	for name, profile := range c.Profiles {
+		if profiles == nil {
+			profiles = map[string]fixrProfileDef{}
+		}
+		profiles[name] = fixrProfileDef{
+			file:    fmt.Sprintf("%s/%s", c.path, c.file),
+			schemas: profile.Schemas,
+			data:    profile.Data,
+		}
+	}
+	return
+}
+
+// merges other into def. schemas with the same name are combined, and other's tables, functions, and
+// data come after def's. returns a description of everything both define.
+func (def *fixrDef) merge(other *fixrDef) (problems []string) {
+	for _, schema := range other.schemas {
+		i := 0
+		for i < len(def.schemas) && def.schemas[i].name != schema.name {
+			i++
+		}
+		if i == len(def.schemas) {
+			def.schemas = append(def.schemas, fixrSchemaDef{name: schema.name})
+		}
+		merged := &def.schemas[i]
+
+		for _, table := range schema.tables {
+			if existing, ok := findDDLDef(merged.tables, table.name); ok {
+				problems = append(problems, fmt.Sprintf("table %s.%s is defined in both %s and %s", schema.name, table.name, existing.file, table.file))
+				continue
+			}
+			merged.tables = append(merged.tables, table)
+		}
+
+		for _, function := range schema.functions {
+			if existing, ok := findDDLDef(merged.functions, function.name); ok {
+				problems = append(problems, fmt.Sprintf("function %s.%s is defined in both %s and %s", schema.name, function.name, existing.file, function.file))
+				continue
+			}
+			merged.functions = append(merged.functions, function)
+		}
+	}
+
+	for _, data := range other.data {
+		conflict := false
+		for _, existing := range def.data {
+			if existing.name == data.name {
+				problems = append(problems, fmt.Sprintf("data %s is defined in both %s and %s", data.name, existing.file, data.file))
+				conflict = true
+				break
+			}
+		}
+		if !conflict {
+			def.data = append(def.data, data)
+		}
+	}
+
+	for _, name := range other.profileNames() {
+		profile := other.profiles[name]
+		if existing, ok := def.profiles[name]; ok {
+			problems = append(problems, fmt.Sprintf("profile %s is defined in both %s and %s", name, existing.file, profile.file))
+			continue
+		}
+		if def.profiles == nil {
+			def.profiles = map[string]fixrProfileDef{}
+		}
+		def.profiles[name] = profile
+	}
+
+	return
+}
+
+func findDDLDef(defs []fixrDDLDef, name string) (fixrDDLDef, bool) {
+	for _, def := range defs {
+		if def.name == name {
+			return def, true
+		}
+	}
+	return fixrDDLDef{}, false
+}
+
+// reads a file of rows - a data file or an expected file
+func (c *fixrConf) loadRows(file string) (rows []map[string]fixrCellDef, err error) {
+	rowsDef, err := ioutil.ReadFile(file)
+	if err != nil {
+		return
+	}
+
+	if strings.HasSuffix(file, ".csv") {
+		rows, err = parseCSVRows(rowsDef)
+	} else {
+		err = yaml.Unmarshal(rowsDef, &rows)
+	}
+	if err != nil {
+		err = fmt.Errorf("%s: %s", file, err)
+		return
+	}
+
+	err = c.expandRows(rows, file)
+	if err != nil {
+		return
+	}
+
+	err = c.loadCellFiles(rows)
+	return
+}
+
+// reads the content of file cells - paths are relative to the config directory
+func (c *fixrConf) loadCellFiles(rows []map[string]fixrCellDef) (err error) {
+	for _, row := range rows {
+		for field, cellDef := range row {
+			if cellDef.file == "" {
+				continue
+			}
+
+			path := cellDef.file
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(c.path, path)
+			}
+			cellDef.binary, err = ioutil.ReadFile(path)
+			if err != nil {
+				return
+			}
+			row[field] = cellDef
+		}
+	}
+
+	return
+}
+
+// finds the config file in dir
+func findConfig(dir string) (filename string, err error) {
+	found := []string{}
+	for _, name := range configFiles {
+		_, e := os.Stat(fmt.Sprintf("%s/%s", dir, name))
+		if e == nil {
+			found = append(found, name)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		err = fmt.Errorf("no config file in %s - expected one of %s", dir, strings.Join(configFiles, ", "))
+	case 1:
+		filename = fmt.Sprintf("%s/%s", dir, found[0])
+	default:
+		err = fmt.Errorf("more than one config file in %s: %s", dir, strings.Join(found, ", "))
+	}
 	return
 }
 
+// reads a json, yaml, or toml config file. unknown fields don't fail here - they are recorded so they can
+// be reported along with everything else wrong with the config in fixrConf.load
 func loadConfig(filename string) (*fixrConf, error) {
 	bytes, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return nil, err
 	}
 
-	conf := &fixrConf{}
+	var raw interface{}
+	switch filepath.Ext(filename) {
+	case ".yml", ".yaml":
+		err = yaml.Unmarshal(bytes, &raw)
+	case ".toml":
+		table := map[string]interface{}{}
+		_, err = toml.Decode(string(bytes), &table)
+		raw = table
+	default:
+		err = json.Unmarshal(bytes, &raw)
+	}
+	if err != nil {
+		return nil, err
+	}
+	raw = normalizeConfig(raw)
+
+	conf := &fixrConf{file: filepath.Base(filename)}
+	conf.problems = unknownFields(raw, reflect.TypeOf(conf).Elem(), "")
+
+	// every format goes through json so there's only one set of field tags to maintain
+	bytes, err = json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
 
 	err = json.Unmarshal(bytes, conf)
 	if err != nil {
@@ -119,9 +503,16 @@ func loadConfig(filename string) (*fixrConf, error) {
 func (d *fixrCellDef) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	toStr := ""
 	toStruct := struct {
-		Value       string `yaml:"value"`
-		Column      string `yaml:"column"`
-		IsParameter *bool  `yaml:"param,omitempty"`
+		Value       string  `yaml:"value"`
+		Column      string  `yaml:"column"`
+		IsParameter *bool   `yaml:"param,omitempty"`
+		Now         *string `yaml:"now,omitempty"`
+		Time        *string `yaml:"time,omitempty"`
+		Format      string  `yaml:"format,omitempty"`
+		File        *string `yaml:"file,omitempty"`
+		Base64      *string `yaml:"base64,omitempty"`
+		Any         bool    `yaml:"any,omitempty"`
+		Regex       *string `yaml:"regex,omitempty"`
 	}{}
 
 	err := unmarshal(&toStr)
@@ -143,6 +534,77 @@ func (d *fixrCellDef) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		} else {
 			d.isParameter = *toStruct.IsParameter
 		}
+
+		// now, time, file, and base64 each say where the value comes from - only one is allowed
+		sources := []string{}
+		for name, source := range map[string]*string{"now": toStruct.Now, "time": toStruct.Time, "file": toStruct.File, "base64": toStruct.Base64} {
+			if source != nil {
+				sources = append(sources, name)
+			}
+		}
+		if len(sources) > 1 {
+			sort.Strings(sources)
+			return fmt.Errorf("cell can only have one of now, time, file, or base64 - found %s", strings.Join(sources, ", "))
+		}
+
+		// relative times - evaluated at SetUp and always sent as parameters
+		if toStruct.Now != nil || toStruct.Time != nil {
+			d.isTime = true
+			d.isParameter = true
+			if toStruct.Now != nil {
+				d.timeExpr = *toStruct.Now
+			} else {
+				d.timeExpr = *toStruct.Time
+			}
+
+			d.timeFormat = toStruct.Format
+			if d.timeFormat == "" {
+				d.timeFormat = defaultTimeFormat
+			}
+
+			// make sure the expression is valid now rather than at insert time
+			_, err = relativeTime(d.timeExpr, time.Time{})
+			if err != nil {
+				return err
+			}
+		}
+
+		// binary values - sent as []byte parameters. files are read in fixrConf.load since
+		// they are relative to the config directory
+		if toStruct.File != nil {
+			d.isBinary = true
+			d.isParameter = true
+			d.file = *toStruct.File
+		}
+
+		if toStruct.Base64 != nil {
+			d.isBinary = true
+			d.isParameter = true
+			d.binary, err = base64.StdEncoding.DecodeString(*toStruct.Base64)
+			if err != nil {
+				return fmt.Errorf("invalid base64 value: %s", err)
+			}
+		}
+
+		// matchers - for comparing with the rows in a table
+		if toStruct.Any {
+			if len(sources) > 0 {
+				return fmt.Errorf("any can't be used with now, time, file, or base64")
+			}
+			d.isMatcher = true
+			d.any = true
+		}
+
+		if toStruct.Regex != nil {
+			if d.isMatcher || len(sources) > 0 {
+				return fmt.Errorf("regex can't be used with any, now, time, file, or base64")
+			}
+			d.isMatcher = true
+			d.pattern, err = regexp.Compile(*toStruct.Regex)
+			if err != nil {
+				return fmt.Errorf("invalid regex: %s", err)
+			}
+		}
 	}
 
 	d.notNil = true
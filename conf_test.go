@@ -1,7 +1,13 @@
 package fixrupr
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
 	. "gopkg.in/check.v1"
+	"gopkg.in/yaml.v2"
 )
 
 var (
@@ -29,7 +35,16 @@ var (
       "blog.comments.article1",
       "blog.comments.article2",
       "reporting.reports"
-  ]
+  ],
+  "profiles": {
+    "minimal": {
+      "schemas": ["blog"],
+      "data": ["blog.users"]
+    },
+    "comments": {
+      "data": ["blog.comments.article2", "blog.users"]
+    }
+  }
 }
 	`
 
@@ -105,14 +120,14 @@ func (s *MySuite) Test_fixrConf_load(c *C) {
 	c.Assert(def.schemas, HasLen, 2)
 	c.Check(def.schemas[0].name, Equals, "blog")
 	c.Assert(def.schemas[0].tables, HasLen, 3)
-	c.Check(def.schemas[0].tables[0], Equals, "choo-choo")
-	c.Check(def.schemas[0].tables[1], Equals, "egyptian")
-	c.Check(def.schemas[0].tables[2], Equals, "turkish")
+	c.Check(def.schemas[0].tables[0].ddl, Equals, "choo-choo")
+	c.Check(def.schemas[0].tables[1].ddl, Equals, "egyptian")
+	c.Check(def.schemas[0].tables[2].ddl, Equals, "turkish")
 	c.Assert(def.schemas[0].functions, HasLen, 1)
-	c.Check(def.schemas[0].functions[0], Equals, "taqsim")
+	c.Check(def.schemas[0].functions[0].ddl, Equals, "taqsim")
 	c.Check(def.schemas[1].name, Equals, "reporting")
 	c.Assert(def.schemas[1].tables, HasLen, 1)
-	c.Check(def.schemas[1].tables[0], Equals, "samiha")
+	c.Check(def.schemas[1].tables[0].ddl, Equals, "samiha")
 	c.Check(def.schemas[1].functions, HasLen, 0)
 
 	c.Assert(def.data, HasLen, 5)
@@ -202,3 +217,232 @@ func (s *MySuite) Test_fixrConf_load(c *C) {
 	c.Assert(def.data[4].rows[0]["report"].notNil, Equals, true)
 	c.Assert(def.data[4].rows[0]["report"].value, Equals, "now()")
 }
+
+func (s *MySuite) Test_fixrCellDef_UnmarshalYAML_time(c *C) {
+	rows := []map[string]fixrCellDef{}
+	err := yaml.Unmarshal([]byte(`
+- expires:
+    now: "+7d"
+  created:
+    time: "now-2h"
+    format: "2006-01-02"
+`), &rows)
+	c.Assert(err, IsNil)
+	c.Assert(rows, HasLen, 1)
+
+	c.Check(rows[0]["expires"].isTime, Equals, true)
+	c.Check(rows[0]["expires"].isParameter, Equals, true)
+	c.Check(rows[0]["expires"].notNil, Equals, true)
+	c.Check(rows[0]["expires"].timeExpr, Equals, "+7d")
+	c.Check(rows[0]["expires"].timeFormat, Equals, defaultTimeFormat)
+	c.Check(rows[0]["created"].isTime, Equals, true)
+	c.Check(rows[0]["created"].timeExpr, Equals, "now-2h")
+	c.Check(rows[0]["created"].timeFormat, Equals, "2006-01-02")
+
+	err = yaml.Unmarshal([]byte(`
+- expires:
+    now: "next tuesday"
+`), &rows)
+	c.Check(err, NotNil)
+
+	err = yaml.Unmarshal([]byte(`
+- expires:
+    now: "+1d"
+    time: "now+1d"
+`), &rows)
+	c.Check(err, NotNil)
+}
+
+func (s *MySuite) Test_fixrCellDef_UnmarshalYAML_binary(c *C) {
+	rows := []map[string]fixrCellDef{}
+	err := yaml.Unmarshal([]byte(`
+- avatar:
+    file: blobs/avatar.png
+  payload:
+    base64: "AAEC/w=="
+`), &rows)
+	c.Assert(err, IsNil)
+	c.Assert(rows, HasLen, 1)
+
+	c.Check(rows[0]["avatar"].isBinary, Equals, true)
+	c.Check(rows[0]["avatar"].isParameter, Equals, true)
+	c.Check(rows[0]["avatar"].file, Equals, "blobs/avatar.png")
+	c.Check(rows[0]["avatar"].binary, IsNil)
+	c.Check(rows[0]["payload"].isBinary, Equals, true)
+	c.Check(rows[0]["payload"].binary, DeepEquals, []byte{0, 1, 2, 255})
+
+	err = yaml.Unmarshal([]byte(`
+- payload:
+    base64: "not base64!"
+`), &rows)
+	c.Check(err, NotNil)
+
+	err = yaml.Unmarshal([]byte(`
+- payload:
+    base64: "AAEC/w=="
+    file: blobs/avatar.png
+`), &rows)
+	c.Check(err, ErrorMatches, "cell can only have one of now, time, file, or base64 - found base64, file")
+}
+
+func (s *MySuite) Test_fixrConf_loadCellFiles(c *C) {
+	dir := c.MkDir()
+	os.MkdirAll(fmt.Sprintf("%s/blobs", dir), 0755)
+	ioutil.WriteFile(fmt.Sprintf("%s/blobs/avatar.png", dir), []byte{137, 80, 78, 71}, 0755)
+
+	conf := &fixrConf{path: dir}
+	rows := []map[string]fixrCellDef{{
+		"id":     {notNil: true, isParameter: true, value: "1"},
+		"avatar": {notNil: true, isParameter: true, isBinary: true, file: "blobs/avatar.png"},
+	}}
+
+	err := conf.loadCellFiles(rows)
+	c.Assert(err, IsNil)
+	c.Check(rows[0]["avatar"].binary, DeepEquals, []byte{137, 80, 78, 71})
+	c.Check(rows[0]["id"].binary, IsNil)
+
+	// absolute paths aren't relative to the config directory
+	other := c.MkDir()
+	ioutil.WriteFile(filepath.Join(other, "banner.png"), []byte{1, 2}, 0755)
+	rows[0]["avatar"] = fixrCellDef{notNil: true, isParameter: true, isBinary: true, file: filepath.Join(other, "banner.png")}
+	err = conf.loadCellFiles(rows)
+	c.Assert(err, IsNil)
+	c.Check(rows[0]["avatar"].binary, DeepEquals, []byte{1, 2})
+
+	rows[0]["avatar"] = fixrCellDef{notNil: true, isParameter: true, isBinary: true, file: "blobs/missing.png"}
+	err = conf.loadCellFiles(rows)
+	c.Check(err, NotNil)
+}
+
+func (s *MySuite) Test_fixrConf_load_allProblems(c *C) {
+	root := c.MkDir()
+	files := map[string]string{
+		"shared/test.config.yml":                  "schemas:\n  - name: accounts\n    tables: [users]\ndata: [accounts.users]\n",
+		"shared/data/accounts.users.yml":          "- id: 1\n",
+		"shared/schema/accounts/tables/users.sql": "create users",
+		"service/test.config.yml": "include: [../shared]\nschemas:\n  - name: accounts\n    tables: [users]\n" +
+			"data: [accounts.users, accounts.nope]\nprofiles:\n  minimal:\n    schemas: [billing]\n",
+	}
+	for name, content := range files {
+		os.MkdirAll(filepath.Dir(fmt.Sprintf("%s/%s", root, name)), 0755)
+		ioutil.WriteFile(fmt.Sprintf("%s/%s", root, name), []byte(content), 0755)
+	}
+
+	conf, err := loadConfig(fmt.Sprintf("%s/service/test.config.yml", root))
+	c.Assert(err, IsNil)
+	conf.path = fmt.Sprintf("%s/service", root)
+
+	// the config's own problems don't hide the conflicts with its includes, or the profile problems
+	_, err = conf.load()
+	c.Assert(err, FitsTypeOf, &confError{})
+	c.Check(err.(*confError).problems, DeepEquals, []string{
+		`data "accounts.nope" is for table "nope", which is not declared in schema "accounts"`,
+		fmt.Sprintf("data accounts.users is defined in both %s/shared/data/accounts.users.yml and %s/service/data/accounts.users.yml", root, root),
+		`profile minimal lists schema "billing", which is not declared`,
+	})
+}
+
+func (s *MySuite) Test_fixrConf_load_include(c *C) {
+	root := c.MkDir()
+	files := map[string]string{
+		"shared/test.config.yml":                      "schemas:\n  - name: accounts\n    tables: [users]\ndata: [accounts.users]\n",
+		"shared/schema/accounts/tables/users.sql":     "create users",
+		"shared/data/accounts.users.yml":              "- id: 1\n",
+		"service/test.config.json":                    `{"include": ["../shared"], "schemas": [{"name": "accounts", "tables": ["sessions"]}, {"name": "billing", "tables": ["invoices"]}], "data": ["accounts.sessions", "accounts.users.extra", "billing.invoices"]}`,
+		"service/schema/accounts/tables/sessions.sql": "create sessions",
+		"service/schema/billing/tables/invoices.sql":  "create invoices",
+		"service/data/accounts.sessions.yml":          "- id: 1\n",
+		"service/data/accounts.users.extra.yml":       "- id: 2\n",
+		"service/data/billing.invoices.yml":           "- id: 1\n",
+	}
+	for name, content := range files {
+		os.MkdirAll(filepath.Dir(fmt.Sprintf("%s/%s", root, name)), 0755)
+		ioutil.WriteFile(fmt.Sprintf("%s/%s", root, name), []byte(content), 0755)
+	}
+
+	conf, err := loadConfig(fmt.Sprintf("%s/service/test.config.json", root))
+	c.Assert(err, IsNil)
+	conf.path = fmt.Sprintf("%s/service", root)
+
+	def, err := conf.load()
+	c.Assert(err, IsNil)
+	c.Assert(def.schemas, HasLen, 2)
+	c.Check(def.schemas[0].name, Equals, "accounts")
+	c.Assert(def.schemas[0].tables, HasLen, 2)
+	c.Check(def.schemas[0].tables[0].ddl, Equals, "create users")
+	c.Check(def.schemas[0].tables[1].ddl, Equals, "create sessions")
+	c.Check(def.schemas[1].name, Equals, "billing")
+	c.Assert(def.schemas[1].tables, HasLen, 1)
+	c.Check(def.schemas[1].tables[0].ddl, Equals, "create invoices")
+
+	c.Assert(def.data, HasLen, 4)
+	c.Check(def.data[0].name, Equals, "accounts.users")
+	c.Check(def.data[1].name, Equals, "accounts.sessions")
+	c.Check(def.data[2].name, Equals, "accounts.users.extra")
+	c.Check(def.data[2].table, Equals, "users")
+	c.Check(def.data[3].name, Equals, "billing.invoices")
+
+	// conflicts - the service defines the shared users table again
+	os.MkdirAll(fmt.Sprintf("%s/service/schema/accounts/tables", root), 0755)
+	ioutil.WriteFile(fmt.Sprintf("%s/service/schema/accounts/tables/users.sql", root), []byte("create users again"), 0755)
+	ioutil.WriteFile(fmt.Sprintf("%s/service/data/accounts.users.yml", root), []byte("- id: 3\n"), 0755)
+	ioutil.WriteFile(fmt.Sprintf("%s/service/test.config.json", root), []byte(`{"include": ["../shared"], "schemas": [{"name": "accounts", "tables": ["users"]}], "data": ["accounts.users"]}`), 0755)
+
+	conf, err = loadConfig(fmt.Sprintf("%s/service/test.config.json", root))
+	c.Assert(err, IsNil)
+	conf.path = fmt.Sprintf("%s/service", root)
+
+	_, err = conf.load()
+	c.Assert(err, FitsTypeOf, &confError{})
+	c.Assert(err.(*confError).problems, HasLen, 2)
+	c.Check(err.(*confError).problems[0], Matches, "table accounts.users is defined in both .*/shared/schema/accounts/tables/users.sql and .*/service/schema/accounts/tables/users.sql")
+	c.Check(err.(*confError).problems[1], Matches, "data accounts.users is defined in both .*/shared/data/accounts.users.yml and .*/service/data/accounts.users.yml")
+
+	// cycles
+	ioutil.WriteFile(fmt.Sprintf("%s/shared/test.config.yml", root), []byte("include: [../service]\n"), 0755)
+	conf, err = loadConfig(fmt.Sprintf("%s/service/test.config.json", root))
+	c.Assert(err, IsNil)
+	conf.path = fmt.Sprintf("%s/service", root)
+
+	_, err = conf.load()
+	c.Check(err, ErrorMatches, "include cycle: .*/service -> .*/shared -> .*/service")
+}
+
+func (s *MySuite) Test_fixrCellDef_UnmarshalYAML_matchers(c *C) {
+	rows := []map[string]fixrCellDef{}
+	err := yaml.Unmarshal([]byte(`
+- created:
+    any: true
+  comment:
+    regex: "^c.*!$"
+`), &rows)
+	c.Assert(err, IsNil)
+	c.Assert(rows, HasLen, 1)
+	c.Check(rows[0]["created"].isMatcher, Equals, true)
+	c.Check(rows[0]["created"].any, Equals, true)
+	c.Check(rows[0]["comment"].isMatcher, Equals, true)
+	c.Check(rows[0]["comment"].pattern.String(), Equals, "^c.*!$")
+
+	err = yaml.Unmarshal([]byte(`
+- comment:
+    regex: "(["
+`), &rows)
+	c.Check(err, NotNil)
+
+	err = yaml.Unmarshal([]byte(`
+- comment:
+    regex: "^c"
+    any: true
+`), &rows)
+	c.Check(err, NotNil)
+
+	// matchers can't be used in data files
+	dir := s.help_mockFiles(c)
+	ioutil.WriteFile(fmt.Sprintf("%s/data/blog.users.yml", dir), []byte("- id:\n    any: true\n"), 0755)
+	conf, err := loadConfig(fmt.Sprintf("%s/test.config.json", dir))
+	c.Assert(err, IsNil)
+	conf.path = dir
+
+	_, err = conf.load()
+	c.Check(err, ErrorMatches, ".*/data/blog.users.yml: id: any and regex can only be used in expected files")
+}
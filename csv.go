@@ -0,0 +1,33 @@
+package fixrupr
+
+import (
+	"bytes"
+	"encoding/csv"
+)
+
+// the value that means NULL in a csv data file - the same as in load data files
+const csvNull = `\N`
+
+// parses the rows of a csv data file. the first record names the columns, and every value is inserted
+// as a parameter.
+func parseCSVRows(content []byte) (rows []map[string]fixrCellDef, err error) {
+	records, err := csv.NewReader(bytes.NewReader(content)).ReadAll()
+	if err != nil || len(records) == 0 {
+		return
+	}
+
+	// the reader makes sure every record has as many fields as the header
+	header := records[0]
+	for _, record := range records[1:] {
+		row := map[string]fixrCellDef{}
+		for j, value := range record {
+			if value == csvNull {
+				row[header[j]] = fixrCellDef{isParameter: true}
+			} else {
+				row[header[j]] = fixrCellDef{notNil: true, isParameter: true, value: value}
+			}
+		}
+		rows = append(rows, row)
+	}
+	return
+}
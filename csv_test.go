@@ -0,0 +1,25 @@
+package fixrupr
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) Test_parseCSVRows(c *C) {
+	rows, err := parseCSVRows([]byte("id,username,bio\n1,babyBuggy,\"likes, commas\"\n2,stinkBug,\\N\n"))
+	c.Assert(err, IsNil)
+	c.Check(rows, DeepEquals, []map[string]fixrCellDef{
+		{
+			"id":       {notNil: true, isParameter: true, value: "1"},
+			"username": {notNil: true, isParameter: true, value: "babyBuggy"},
+			"bio":      {notNil: true, isParameter: true, value: "likes, commas"},
+		},
+		{
+			"id":       {notNil: true, isParameter: true, value: "2"},
+			"username": {notNil: true, isParameter: true, value: "stinkBug"},
+			"bio":      {isParameter: true},
+		},
+	})
+
+	_, err = parseCSVRows([]byte("id,username\n1\n"))
+	c.Check(err, NotNil)
+}
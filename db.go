@@ -1,37 +1,92 @@
 package fixrupr
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"os"
 	"sort"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 type fixrConn interface {
 	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// a connection pool - *sql.DB. session settings and locks only apply to the connection they were set
+// on, so statements that rely on them need a single connection out of the pool.
+type fixrPool interface {
+	Conn(ctx context.Context) (*sql.Conn, error)
+}
+
+// a single connection from a pool
+type fixrSession struct {
+	conn *sql.Conn
+}
+
+func (s fixrSession) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return s.conn.ExecContext(context.Background(), query, args...)
+}
+
+func (s fixrSession) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return s.conn.QueryContext(context.Background(), query, args...)
+}
+
+// gets a single connection to run statements that rely on session settings. anything that isn't a pool
+// is used as it is. release gives the connection back.
+func (f *Fixr) session() (conn fixrConn, release func(), err error) {
+	pool, ok := f.conn.(fixrPool)
+	if !ok {
+		return f.conn, func() {}, nil
+	}
+
+	c, err := pool.Conn(context.Background())
+	if err != nil {
+		return
+	}
+	return fixrSession{conn: c}, func() { c.Close() }, nil
 }
 
 // creates all the schemas and tables and functions
 func (f *Fixr) create() (err error) {
-	for _, schema := range f.def.schemas {
-		err = f.schema(schema.name)
-		if err != nil {
-			return
-		}
-
-		for _, table := range schema.tables {
-			err = f.table(schema.name, table)
+	if f.parallelism > 1 {
+		err = f.createParallel()
+	} else {
+		for _, schema := range f.activeDef().schemas {
+			err = f.createSchema(schema)
 			if err != nil {
 				return
 			}
 		}
+	}
+	if err != nil {
+		return
+	}
+
+	return f.checkDefinitions()
+}
+
+// creates a schema and its tables and functions
+func (f *Fixr) createSchema(schema fixrSchemaDef) (err error) {
+	err = f.schema(schema.name)
+	if err != nil {
+		return
+	}
+
+	for _, table := range schema.tables {
+		err = f.table(schema.name, table)
+		if err != nil {
+			return
+		}
+	}
 
-		for _, function := range schema.functions {
-			err = f.function(schema.name, function)
-			if err != nil {
-				return
-			}
+	for _, function := range schema.functions {
+		err = f.function(schema.name, function)
+		if err != nil {
+			return
 		}
 	}
 
@@ -40,7 +95,11 @@ func (f *Fixr) create() (err error) {
 
 // inserts all the rows
 func (f *Fixr) insert() (err error) {
-	for _, d := range f.def.data {
+	if f.parallelism > 1 {
+		return f.insertParallel()
+	}
+
+	for _, d := range f.activeDef().data {
 		err = f.load(f.prefix, d)
 		if err != nil {
 			return
@@ -49,9 +108,51 @@ func (f *Fixr) insert() (err error) {
 	return
 }
 
+// deletes all the rows - every table is truncated, and views are skipped
+func (f *Fixr) clear() (err error) {
+	// truncate won't touch a table other tables have foreign keys to, even empty ones, unless foreign key
+	// checks are off - and they're only off for the connection that turned them off
+	conn, release, err := f.session()
+	if err != nil {
+		return
+	}
+	defer release()
+
+	query := "set foreign_key_checks = 0"
+	_, err = conn.Exec(query)
+	if err != nil {
+		err = newDbError(err, query, []interface{}{})
+		return
+	}
+	defer func() {
+		query := "set foreign_key_checks = 1"
+		_, e := conn.Exec(query)
+		if e != nil && err == nil {
+			err = newDbError(e, query, []interface{}{})
+		}
+	}()
+
+	schemas := f.activeDef().schemas
+	for i := len(schemas) - 1; i >= 0; i-- {
+		for j := len(schemas[i].tables) - 1; j >= 0; j-- {
+			// views don't have any rows of their own
+			if isView(schemas[i].tables[j].ddl) {
+				continue
+			}
+			query = fmt.Sprintf("truncate table `%s_%s`.`%s`", f.prefix, schemas[i].name, schemas[i].tables[j].name)
+			_, err = conn.Exec(query)
+			if err != nil {
+				err = newDbError(err, query, []interface{}{})
+				return
+			}
+		}
+	}
+	return
+}
+
 // drops all the schemas
 func (f *Fixr) drop() (err error) {
-	for _, schema := range f.def.schemas {
+	for _, schema := range f.activeDef().schemas {
 		query := fmt.Sprintf("drop schema `%s_%s`", f.prefix, schema.name)
 		_, e := f.conn.Exec(query)
 		if e != nil {
@@ -98,18 +199,21 @@ func (f *Fixr) schema(name string) (err error) {
 }
 
 // creates a table
-func (f *Fixr) table(schema string, ddl string) (err error) {
+func (f *Fixr) table(schema string, ddl fixrDDLDef) (err error) {
 	return f.exec(schema, ddl)
 }
 
 // creates a function
-func (f *Fixr) function(schema string, ddl string) error {
+func (f *Fixr) function(schema string, ddl fixrDDLDef) error {
 	return f.exec(schema, ddl)
 }
 
 // executes ddl
-func (f *Fixr) exec(schema string, ddl string) (err error) {
-	query := strings.Replace(string(ddl), "{{schema}}", fmt.Sprintf("%s_%s", f.prefix, schema), -1)
+func (f *Fixr) exec(schema string, ddl fixrDDLDef) (err error) {
+	query, err := f.renderDDL(schema, ddl)
+	if err != nil {
+		return
+	}
 	_, err = f.conn.Exec(query)
 	if err != nil {
 		err = newDbError(err, query, []interface{}{})
@@ -117,33 +221,56 @@ func (f *Fixr) exec(schema string, ddl string) (err error) {
 	return
 }
 
-// inserts a group of rows
+// inserts a group of rows - in as many inserts as it takes to stay under the batch limits
 func (f *Fixr) load(prefix string, data fixrDataDef) (err error) {
 	if len(data.rows) == 0 {
 		return
 	}
 
+	if f.bulkLoadable(data) {
+		var fallback bool
+		fallback, err = f.loadInfile(prefix, data)
+		if !fallback {
+			return
+		}
+		// the server doesn't allow it - don't bother trying again
+		atomic.StoreInt32(&f.bulkUnsupported, 1)
+	}
+
 	fields := getInsertFields(data.rows)
 	rows := []string{}
-	parameters := []interface{}{}
+	parameters := [][]interface{}{}
 	for _, row := range data.rows {
-		rowInsert, rowParams := generateInsert(fields, row)
+		rowInsert, rowParams, e := generateInsert(fields, row, f.now)
+		if e != nil {
+			err = e
+			return
+		}
 		rows = append(rows, fmt.Sprintf("(%s)", strings.Join(rowInsert, ",")))
-		parameters = append(parameters, rowParams...)
+		parameters = append(parameters, rowParams)
 	}
 
-	query := fmt.Sprintf(
-		"insert into `%s_%s`.`%s` (%s) VALUES %s",
+	insert := fmt.Sprintf(
+		"insert into `%s_%s`.`%s` (%s) VALUES ",
 		prefix,
 		data.schema,
 		data.table,
 		strings.Join(fields, ","),
-		strings.Join(rows, ","),
 	)
 
-	_, err = f.conn.Exec(query, parameters...)
-	if err != nil {
-		err = newDbError(err, query, parameters)
+	chunks := f.batch(len(insert), rows, parameters)
+	for i, chunk := range chunks {
+		query := insert + strings.Join(rows[chunk.first:chunk.last], ",")
+		params := []interface{}{}
+		for _, rowParams := range parameters[chunk.first:chunk.last] {
+			params = append(params, rowParams...)
+		}
+
+		_, e := f.conn.Exec(query, params...)
+		if e != nil {
+			err = newBatchError(data, i, len(chunks), chunk, newDbError(e, query, params))
+			return
+		}
 	}
 	return
 }
@@ -177,7 +304,8 @@ func getInsertFields(rows []map[string]fixrCellDef) []string {
 }
 
 // generates the insert values and params for a single row
-func generateInsert(fields []string, row map[string]fixrCellDef) (values []string, params []interface{}) {
+// now: the time relative time cells are evaluated against
+func generateInsert(fields []string, row map[string]fixrCellDef, now time.Time) (values []string, params []interface{}, err error) {
 	params = []interface{}{}
 	values = []string{}
 
@@ -195,6 +323,17 @@ func generateInsert(fields []string, row map[string]fixrCellDef) (values []strin
 			if !cellDef.notNil {
 				values = append(values, "?")
 				params = append(params, nil)
+			} else if cellDef.isTime {
+				var t time.Time
+				t, err = relativeTime(cellDef.timeExpr, now)
+				if err != nil {
+					return
+				}
+				values = append(values, "?")
+				params = append(params, t.Format(cellDef.timeFormat))
+			} else if cellDef.isBinary {
+				values = append(values, "?")
+				params = append(params, cellDef.binary)
 			} else if cellDef.isParameter {
 				values = append(values, "?")
 				params = append(params, cellDef.value)
@@ -1,21 +1,145 @@
 package fixrupr
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
 	"os"
+	"strings"
+	"sync"
+	"time"
 
 	. "gopkg.in/check.v1"
 )
 
 type mockDb struct {
+	lock    sync.Mutex
 	queries []string
 	args    [][]interface{}
+
+	// what Query returns
+	columns []string
+	results [][]driver.Value
+
+	// what Exec returns, by the index of the query
+	errs map[int]error
+	// the rows Exec says it affected, by the index of the query - unknown if it isn't set
+	affected map[int]int64
+
+	// what the query for routine and view definitions returns - kind, schema, name, definition
+	definitions [][]driver.Value
+
+	// what the query for a template's foreign keys returns - schema, table, constraint, column,
+	// referenced schema, referenced table, referenced column, update rule, delete rule
+	foreignKeys [][]driver.Value
+
+	// what the query for the template schemas returns - their names
+	schemata [][]driver.Value
+
+	// what get_lock returns - 1 unless it's set
+	locked driver.Value
 }
 
 func (m *mockDb) Exec(query string, args ...interface{}) (sql.Result, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
 	m.queries = append(m.queries, query)
 	m.args = append(m.args, args)
-	return nil, nil
+	affected, ok := m.affected[len(m.queries)-1]
+	if !ok {
+		return driver.ResultNoRows, m.errs[len(m.queries)-1]
+	}
+	return driver.RowsAffected(affected), m.errs[len(m.queries)-1]
+}
+
+// *sql.Rows can only come from a driver - mockDb's results are served by mockDriver
+func (m *mockDb) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	m.lock.Lock()
+	m.queries = append(m.queries, query)
+	m.args = append(m.args, args)
+	m.lock.Unlock()
+
+	mockDbs.Store(fmt.Sprintf("%p", m), m)
+	db, err := sql.Open("fixrupr-mock", fmt.Sprintf("%p", m))
+	if err != nil {
+		return nil, err
+	}
+	return db.Query(query, args...)
+}
+
+var mockDbs = sync.Map{}
+
+type mockDriver struct{}
+
+type mockConn struct {
+	db *mockDb
+}
+
+type mockRows struct {
+	columns []string
+	results [][]driver.Value
+	next    int
+}
+
+func init() {
+	sql.Register("fixrupr-mock", mockDriver{})
+}
+
+func (d mockDriver) Open(name string) (driver.Conn, error) {
+	db, _ := mockDbs.Load(name)
+	return &mockConn{db: db.(*mockDb)}, nil
+}
+
+func (c *mockConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("prepare isn't supported")
+}
+
+func (c *mockConn) Close() error {
+	return nil
+}
+
+func (c *mockConn) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("transactions aren't supported")
+}
+
+func (c *mockConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if strings.Contains(query, "information_schema.routines") {
+		return &mockRows{columns: []string{"kind", "schema", "name", "definition"}, results: c.db.definitions}, nil
+	}
+	if strings.Contains(query, "information_schema.key_column_usage") {
+		return &mockRows{columns: []string{"table_schema", "table_name", "constraint_name", "column_name", "referenced_table_schema",
+			"referenced_table_name", "referenced_column_name", "update_rule", "delete_rule"}, results: c.db.foreignKeys}, nil
+	}
+	if strings.Contains(query, "information_schema.schemata") {
+		return &mockRows{columns: []string{"schema_name"}, results: c.db.schemata}, nil
+	}
+	if strings.Contains(query, "get_lock") {
+		locked := c.db.locked
+		if locked == nil {
+			locked = int64(1)
+		}
+		return &mockRows{columns: []string{"locked"}, results: [][]driver.Value{{locked}}}, nil
+	}
+	return &mockRows{columns: c.db.columns, results: c.db.results}, nil
+}
+
+func (r *mockRows) Columns() []string {
+	return r.columns
+}
+
+func (r *mockRows) Close() error {
+	return nil
+}
+
+func (r *mockRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.results) {
+		return io.EOF
+	}
+	copy(dest, r.results[r.next])
+	r.next++
+	return nil
 }
 
 func (m *mockDb) clear() {
@@ -40,8 +164,8 @@ func (s *MySuite) Test_fixr_create(c *C) {
 
 	err := fixr.create()
 	c.Check(err, IsNil)
-	c.Assert(conn.queries, HasLen, 9)
-	c.Assert(conn.args, HasLen, 9)
+	c.Assert(conn.queries, HasLen, 10)
+	c.Assert(conn.args, HasLen, 10)
 
 	c.Check(conn.queries[0], Equals, "insert into `jamila`.schemas (name, prefix, hostname) values (?, ?, ?)")
 	c.Assert(conn.args[0], HasLen, 3)
@@ -75,6 +199,22 @@ func (s *MySuite) Test_fixr_create(c *C) {
 
 	c.Check(conn.queries[8], Equals, "samiha")
 	c.Check(conn.args[8], HasLen, 0)
+
+	// the function is checked for schema names without the prefix
+	c.Check(conn.queries[9], Matches, "select .* from information_schema.routines .*")
+	c.Check(conn.args[9], DeepEquals, []interface{}{"v_test_blog", "v_test_reporting", "v_test_blog", "v_test_reporting"})
+}
+
+func (s *MySuite) Test_fixr_exec(c *C) {
+	conn := &mockDb{}
+	fixr := &Fixr{conn: conn, prefix: "v_test"}
+
+	err := fixr.exec("reporting", fixrDDLDef{name: "totals", ddl: "create view {{schema}}.totals as select * from {{pf:blog.articles}} a " +
+		"join `{{pf:blog}}`.users u where a.note != '{{pf:blog}} in {{schema}}'"})
+	c.Check(err, IsNil)
+	c.Assert(conn.queries, HasLen, 1)
+	c.Check(conn.queries[0], Equals, "create view v_test_reporting.totals as select * from `v_test_blog`.`articles` a "+
+		"join `v_test_blog`.users u where a.note != '{{pf:blog}} in v_test_reporting'")
 }
 
 func (s *MySuite) Test_fixr_drop(c *C) {
@@ -165,3 +305,88 @@ func (s *MySuite) Test_fixr_insert(c *C) {
 	c.Check(conn.args[4][0], Equals, "1")
 	c.Check(conn.args[4][1], Equals, "now()")
 }
+
+func (s *MySuite) Test_fixr_insert_time(c *C) {
+	now := time.Date(2015, 3, 15, 12, 30, 0, 0, time.UTC)
+	conn := &mockDb{}
+	fixr := &Fixr{
+		conn:   conn,
+		prefix: "v_test",
+		now:    now,
+	}
+
+	err := fixr.load(fixr.prefix, fixrDataDef{
+		schema: "blog",
+		table:  "users",
+		rows: []map[string]fixrCellDef{{
+			"joined":  {notNil: true, isParameter: true, isTime: true, timeExpr: "-3d", timeFormat: defaultTimeFormat},
+			"expires": {notNil: true, isParameter: true, isTime: true, timeExpr: "now+2h", timeFormat: "2006-01-02"},
+		}},
+	})
+	c.Check(err, IsNil)
+	c.Assert(conn.queries, HasLen, 1)
+	c.Check(conn.queries[0], Equals, "insert into `v_test_blog`.`users` (`expires`,`joined`) VALUES (?,?)")
+	c.Assert(conn.args[0], HasLen, 2)
+	c.Check(conn.args[0][0], Equals, "2015-03-15")
+	c.Check(conn.args[0][1], Equals, "2015-03-12 12:30:00")
+}
+
+func (s *MySuite) Test_fixr_insert_binary(c *C) {
+	conn := &mockDb{}
+	fixr := &Fixr{
+		conn:   conn,
+		prefix: "v_test",
+	}
+
+	err := fixr.load(fixr.prefix, fixrDataDef{
+		schema: "blog",
+		table:  "users",
+		rows: []map[string]fixrCellDef{{
+			"id":     {notNil: true, isParameter: true, value: "1"},
+			"avatar": {notNil: true, isParameter: true, isBinary: true, binary: []byte{0, 1, 2, 255}},
+		}},
+	})
+	c.Check(err, IsNil)
+	c.Assert(conn.queries, HasLen, 1)
+	c.Check(conn.queries[0], Equals, "insert into `v_test_blog`.`users` (`avatar`,`id`) VALUES (?,?)")
+	c.Assert(conn.args[0], HasLen, 2)
+	c.Check(conn.args[0][0], DeepEquals, []byte{0, 1, 2, 255})
+	c.Check(conn.args[0][1], Equals, "1")
+}
+
+func (s *MySuite) Test_fixr_clear(c *C) {
+	conf := s.mock_fixrConf(c)
+	def, _ := conf.load()
+
+	c.Assert(def, NotNil)
+
+	conn := &mockDb{}
+	fixr := &Fixr{
+		conn:   conn,
+		def:    def,
+		prefix: "v_test",
+	}
+
+	err := fixr.clear()
+	c.Check(err, IsNil)
+	c.Check(conn.queries, DeepEquals, []string{
+		"set foreign_key_checks = 0",
+		"truncate table `v_test_reporting`.`reports`",
+		"truncate table `v_test_blog`.`comments`",
+		"truncate table `v_test_blog`.`articles`",
+		"truncate table `v_test_blog`.`users`",
+		"set foreign_key_checks = 1",
+	})
+
+	// views are skipped
+	fixr.def = s.mock_templateDef()
+	conn.clear()
+	err = fixr.clear()
+	c.Check(err, IsNil)
+	c.Check(conn.queries, DeepEquals, []string{
+		"set foreign_key_checks = 0",
+		"truncate table `v_test_blog`.`comments`",
+		"truncate table `v_test_blog`.`users`",
+		"set foreign_key_checks = 1",
+	})
+}
@@ -0,0 +1,240 @@
+package fixrupr
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/verkestk/fixrupr/prefixr"
+)
+
+// the functions ddl templates can use. these stand-ins are only for parsing - the real ones are added when
+// the ddl is rendered, and know the prefix and the current schema.
+var ddlFuncs = template.FuncMap{
+	"schema":  func(names ...string) (string, error) { return "", nil },
+	"schemas": func() map[string]string { return nil },
+	"prefix":  func() string { return "" },
+}
+
+// parses ddl as a template
+// source: the file the ddl came from - it's the template's name, so errors say where they came from
+func parseDDL(ddl string, source string) (*template.Template, error) {
+	// {{pf:name}} placeholders aren't template actions - they're written out as they are, for prefixr
+	ddl = strings.Replace(ddl, "{{pf:", `{{"{{pf:"}}`, -1)
+	return template.New(source).Option("missingkey=error").Funcs(ddlFuncs).Parse(ddl)
+}
+
+// renders a table or function's ddl into the query that creates it. {{schema}} is the physical name of
+// the schema the ddl belongs to, {{schema "name"}} is any other schema's, {{schemas}} maps all of the
+// logical names to the physical ones, {{prefix}} is the prefix, and {{.NAME}} is a variable from
+// WithVars. {{pf:name}} placeholders are then replaced by prefixr.
+func (f *Fixr) renderDDL(schema string, ddl fixrDDLDef) (query string, err error) {
+	source := ddl.file
+	if source == "" {
+		source = ddl.name
+	}
+
+	tmpl := ddl.tmpl
+	if tmpl == nil {
+		tmpl, err = parseDDL(ddl.ddl, source)
+		if err != nil {
+			return
+		}
+	}
+
+	// the parsed template is shared by set ups running at the same time, so each render gets its own copy
+	tmpl, err = tmpl.Clone()
+	if err != nil {
+		return
+	}
+	tmpl.Funcs(template.FuncMap{
+		"schema": func(names ...string) (string, error) {
+			switch {
+			case len(names) == 0:
+				return fmt.Sprintf("%s_%s", f.prefix, schema), nil
+			case len(names) > 1:
+				return "", fmt.Errorf("schema takes at most one name, got %d", len(names))
+			case !f.isSchema(names[0]):
+				return "", fmt.Errorf("unknown schema %q", names[0])
+			}
+			return fmt.Sprintf("%s_%s", f.prefix, names[0]), nil
+		},
+		"schemas": f.ddlSchemas,
+		"prefix":  func() string { return f.prefix },
+	})
+
+	// the variables were looked up when the config was loaded - ddl that didn't come from a file looks
+	// them up now
+	vars := ddl.vars
+	if vars == nil {
+		vars = map[string]string{}
+		for _, v := range ddlVars(tmpl) {
+			if value, ok := lookupVar(v, f.vars); ok {
+				vars[v] = value
+			}
+		}
+	}
+	rendered := strings.Builder{}
+	err = tmpl.Execute(&rendered, vars)
+	if err != nil {
+		return
+	}
+
+	query = prefixr.Prefix(f.prefix, rendered.String())
+	return
+}
+
+// gets the names of the variables a ddl template uses - the {{.NAME}} fields. inside range and with,
+// the dot is something else, so fields there aren't variables.
+func ddlVars(tmpl *template.Template) (names []string) {
+	seen := map[string]bool{}
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n != nil {
+				for _, child := range n.Nodes {
+					walk(child)
+				}
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.ElseList)
+		case *parse.PipeNode:
+			if n != nil {
+				for _, cmd := range n.Cmds {
+					walk(cmd)
+				}
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		case *parse.FieldNode:
+			if !seen[n.Ident[0]] {
+				seen[n.Ident[0]] = true
+				names = append(names, n.Ident[0])
+			}
+		}
+	}
+	if tmpl.Tree != nil {
+		walk(tmpl.Tree.Root)
+	}
+	return
+}
+
+// maps the logical names of all the schemas in the config to the physical ones
+func (f *Fixr) ddlSchemas() map[string]string {
+	schemas := map[string]string{}
+	if f.def != nil {
+		for _, schema := range f.def.schemas {
+			schemas[schema.name] = fmt.Sprintf("%s_%s", f.prefix, schema.name)
+		}
+	}
+	return schemas
+}
+
+// checks whether a schema is in the config - not just the ones being set up
+func (f *Fixr) isSchema(name string) bool {
+	if f.def == nil {
+		return false
+	}
+	for _, schema := range f.def.schemas {
+		if schema.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checks that the functions, procedures, and views that were just created don't use the logical name
+// of a schema in the config - blog.users instead of {{schema "blog"}}.users. those would work against
+// whatever schema happens to have that name, not the fixtures. names qualified by a table alias are left
+// alone.
+func (f *Fixr) checkDefinitions() (err error) {
+	def := f.activeDef()
+	routines, views := false, false
+	for _, schema := range def.schemas {
+		routines = routines || len(schema.functions) > 0
+		for _, table := range schema.tables {
+			views = views || isView(table.ddl)
+		}
+	}
+	if !routines && !views {
+		return
+	}
+
+	// a name qualified by one of these is unprefixed
+	logical := map[string]bool{}
+	for _, schema := range f.def.schemas {
+		logical[schema.name] = true
+	}
+
+	placeholders := []string{}
+	args := []interface{}{}
+	for _, schema := range def.schemas {
+		placeholders = append(placeholders, "?")
+		args = append(args, fmt.Sprintf("%s_%s", f.prefix, schema.name))
+	}
+	in := strings.Join(placeholders, ", ")
+	query := fmt.Sprintf("select lower(routine_type), routine_schema, routine_name, routine_definition from information_schema.routines where routine_schema in (%s) "+
+		"union all select 'view', table_schema, table_name, view_definition from information_schema.views where table_schema in (%s)", in, in)
+	args = append(args, args...)
+
+	rows, err := f.conn.Query(query, args...)
+	if err != nil {
+		err = newDbError(err, query, args)
+		return
+	}
+	defer rows.Close()
+
+	problems := []string{}
+	for rows.Next() {
+		var (
+			kind, schema, name string
+			definition         sql.NullString
+		)
+		err = rows.Scan(&kind, &schema, &name, &definition)
+		if err != nil {
+			err = newDbError(err, query, args)
+			return
+		}
+
+		// a name qualified by an alias isn't a schema, even if the alias is a schema's name
+		compiled := prefixr.Compile(definition.String)
+		aliases := map[string]bool{}
+		for _, alias := range compiled.Aliases() {
+			aliases[alias] = true
+		}
+
+		reported := map[string]bool{}
+		for _, qualifier := range compiled.Qualifiers() {
+			if logical[qualifier] && !aliases[qualifier] && !reported[qualifier] {
+				reported[qualifier] = true
+				problems = append(problems, fmt.Sprintf("%s `%s`.`%s` uses schema %q without the prefix - use {{schema %q}} or {{pf:%s}}",
+					kind, schema, name, qualifier, qualifier, qualifier))
+			}
+		}
+	}
+	err = rows.Err()
+	if err != nil {
+		err = newDbError(err, query, args)
+		return
+	}
+
+	if len(problems) > 0 {
+		err = newDbError(fmt.Errorf("%s", strings.Join(problems, "\n")), query, args)
+	}
+	return
+}
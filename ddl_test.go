@@ -0,0 +1,121 @@
+package fixrupr
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) Test_fixr_renderDDL(c *C) {
+	def := &fixrDef{schemas: []fixrSchemaDef{{name: "blog"}, {name: "reporting"}}}
+	fixr := &Fixr{def: def, prefix: "v_test", vars: map[string]string{"ENGINE": "InnoDB"}}
+
+	query, err := fixr.renderDDL("reporting", fixrDDLDef{name: "totals", ddl: "create table {{schema}}.totals (id int) engine={{.ENGINE}} " +
+		"comment '{{prefix}}' as select * from `{{schema \"blog\"}}`.articles join {{pf:blog.users}} using (id)"})
+	c.Check(err, IsNil)
+	c.Check(query, Equals, "create table v_test_reporting.totals (id int) engine=InnoDB "+
+		"comment 'v_test' as select * from `v_test_blog`.articles join `v_test_blog`.`users` using (id)")
+
+	// errors say which file the ddl came from
+	_, err = fixr.renderDDL("reporting", fixrDDLDef{name: "totals", file: "schema/reporting/tables/totals.sql", ddl: "select * from {{schema \"blgo\"}}.users"})
+	c.Check(err, ErrorMatches, `template: schema/reporting/tables/totals.sql:1:.* unknown schema "blgo"`)
+
+	_, err = fixr.renderDDL("reporting", fixrDDLDef{name: "totals", file: "schema/reporting/tables/totals.sql", ddl: "engine={{.ENGNE}}"})
+	c.Check(err, ErrorMatches, `template: schema/reporting/tables/totals.sql:1:.*map has no entry for key "ENGNE"`)
+
+	// without a file, the name
+	_, err = fixr.renderDDL("reporting", fixrDDLDef{name: "totals", ddl: "{{schema \"blog\" \"reporting\"}}"})
+	c.Check(err, ErrorMatches, `template: totals:1:.* schema takes at most one name, got 2`)
+}
+
+func (s *MySuite) Test_fixrConf_load_ddlTemplates(c *C) {
+	dir := s.help_mockFiles(c)
+	file := fmt.Sprintf("%s/schema/blog/tables/users.sql", dir)
+	ioutil.WriteFile(file, []byte("create table {{schema}}.users (id int) engine={{.ENGINE}} charset={{.FIXRUPR_TEST_CHARSET}} "+
+		"{{with schemas}}{{.blog}}{{end}}"), 0755)
+	os.Setenv("FIXRUPR_TEST_CHARSET", "utf8mb4")
+	defer os.Unsetenv("FIXRUPR_TEST_CHARSET")
+
+	conf := s.mock_fixrConf(c)
+	conf.path = dir
+	conf.vars = map[string]string{"ENGINE": "InnoDB"}
+	def, err := conf.load()
+	c.Assert(err, IsNil)
+	c.Check(def.schemas[0].tables[0].tmpl, NotNil)
+
+	// variables come from WithVars, then the environment - like ${VAR}
+	c.Check(def.schemas[0].tables[0].vars, DeepEquals, map[string]string{"ENGINE": "InnoDB", "FIXRUPR_TEST_CHARSET": "utf8mb4"})
+	fixr := &Fixr{def: def, prefix: "v_test"}
+	query, err := fixr.renderDDL("blog", def.schemas[0].tables[0])
+	c.Check(err, IsNil)
+	c.Check(query, Equals, "create table v_test_blog.users (id int) engine=InnoDB charset=utf8mb4 v_test_blog")
+
+	// the variables go into the ddl hash, since the ddl can use them
+	hash := def.ddlHash()
+	def.schemas[0].tables[0].vars["ENGINE"] = "MyISAM"
+	c.Check(def.ddlHash(), Not(Equals), hash)
+
+	// unknown variables are an error when the config is loaded
+	conf = s.mock_fixrConf(c)
+	conf.path = dir
+	_, err = conf.load()
+	c.Check(err, ErrorMatches, "unknown variable\\(s\\) ENGINE in "+file)
+
+	// ddl that isn't a valid template is an error when the config is loaded
+	ioutil.WriteFile(file, []byte("create table {{schema}.users (id int)"), 0755)
+	conf = s.mock_fixrConf(c)
+	conf.path = dir
+	_, err = conf.load()
+	c.Check(err, ErrorMatches, "template: "+file+":1: .*")
+}
+
+func (s *MySuite) Test_fixr_checkDefinitions(c *C) {
+	def := s.mock_templateDef()
+	def.schemas = append(def.schemas, fixrSchemaDef{name: "reporting"})
+
+	conn := &mockDb{definitions: [][]driver.Value{
+		{[]byte("function"), []byte("v_test_blog"), []byte("copy_article"), []byte("begin insert into reporting.reports select * from `v_test_blog`.articles; end")},
+		{[]byte("function"), []byte("v_test_blog"), []byte("greet"), []byte("return (select count(*) from `v_test_reporting`.reports) -- reporting.reports")},
+		{[]byte("view"), []byte("v_test_blog"), []byte("recent"), []byte("select `blog`.`comments`.`id` AS `id` from `blog`.`comments`")},
+		{[]byte("view"), []byte("v_test_blog"), []byte("aliased"), []byte("select `blog`.`id` AS `id` from `v_test_blog`.`comments` `blog` join `v_test_reporting`.`reports` as reporting on reporting.id = blog.id")},
+		{[]byte("view"), []byte("v_test_blog"), []byte("joined"), []byte("select blog.id from v_test_reporting.reports join v_test_blog.comments blog")},
+		{[]byte("view"), []byte("v_test_blog"), []byte("nested"), []byte("select `reporting`.`id` AS `id` from (`v_test_blog`.`comments` `reporting` " +
+			"join `v_test_blog`.`users` `u` on((`reporting`.`id` = `u`.`id`)))")},
+		{[]byte("procedure"), []byte("v_test_blog"), []byte("hidden"), nil},
+	}}
+	fixr := &Fixr{conn: conn, def: def, prefix: "v_test"}
+
+	err := fixr.checkDefinitions()
+	c.Check(err, ErrorMatches, "function `v_test_blog`.`copy_article` uses schema \"reporting\" without the prefix - use {{schema \"reporting\"}} or {{pf:reporting}}\n"+
+		"view `v_test_blog`.`recent` uses schema \"blog\" without the prefix .*")
+	c.Assert(conn.queries, HasLen, 1)
+	c.Check(conn.args[0], DeepEquals, []interface{}{"v_test_blog", "v_test_reporting", "v_test_blog", "v_test_reporting"})
+
+	// it's a query error, so WithUnprefixedErrors strips the prefix from it
+	var queryErr QueryError
+	c.Assert(errors.As(err, &queryErr), Equals, true)
+	c.Check(queryErr.Query(), Equals, conn.queries[0])
+	fixr.unprefixErrors = true
+	c.Check(fixr.unprefixError(err), ErrorMatches, "(?s)function `blog`.`copy_article` uses schema \"reporting\" .*view `blog`.`recent` .*")
+
+	// nothing to check without functions or views
+	conn = &mockDb{}
+	fixr.conn = conn
+	fixr.def = &fixrDef{schemas: []fixrSchemaDef{{name: "blog", tables: []fixrDDLDef{{name: "users", ddl: "create table {{schema}}.users (id int)"}}}}}
+	c.Check(fixr.checkDefinitions(), IsNil)
+	c.Check(conn.queries, HasLen, 0)
+}
+
+func (s *MySuite) Test_fixr_renderDDL_schemas(c *C) {
+	def := &fixrDef{schemas: []fixrSchemaDef{{name: "blog"}, {name: "reporting"}}}
+	fixr := &Fixr{def: def, prefix: "v_test"}
+
+	query, err := fixr.renderDDL("blog", fixrDDLDef{name: "copy_article", ddl: "{{range $name, $schema := schemas}}{{$name}}={{$schema}} {{end}}" +
+		"insert into `{{index schemas \"reporting\"}}`.reports"})
+	c.Check(err, IsNil)
+	c.Check(query, Equals, "blog=v_test_blog reporting=v_test_reporting insert into `v_test_reporting`.reports")
+}
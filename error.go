@@ -1,9 +1,32 @@
 package fixrupr
 
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/verkestk/fixrupr/prefixr"
+)
+
+// QueryError is an error from a query fixrupr ran. Use errors.As to get at the query:
+//
+//	var queryErr fixrupr.QueryError
+//	if errors.As(err, &queryErr) {
+//		log.Println(queryErr.Query())
+//	}
+type QueryError interface {
+	error
+	Query() string
+	Parameters() []interface{}
+}
+
 type dbError struct {
 	query      string
 	parameters []interface{}
 	err        error
+
+	// set when the prefix should be stripped from the query and message
+	unprefix *prefixr.Prefixr
 }
 
 func newDbError(err error, query string, parameters []interface{}) error {
@@ -13,5 +36,72 @@ func newDbError(err error, query string, parameters []interface{}) error {
 func (e dbError) Error() string {
 	// verbose option:
 	// return fmt.Sprintf("%s\n%s\n%v", e.err.Error(), e.query, e.parameters)
+	if e.unprefix != nil {
+		return e.unprefix.Unprefix(e.err.Error())
+	}
 	return e.err.Error()
 }
+
+// Query gets the query that failed.
+func (e dbError) Query() string {
+	if e.unprefix != nil {
+		return e.unprefix.Unprefix(e.query)
+	}
+	return e.query
+}
+
+// Parameters gets the query's parameters.
+func (e dbError) Parameters() []interface{} {
+	return e.parameters
+}
+
+func (e dbError) Unwrap() error {
+	return e.err
+}
+
+type confError struct {
+	file     string
+	problems []string
+}
+
+func newConfError(file string, problems []string) error {
+	return &confError{file: file, problems: problems}
+}
+
+func (e confError) Error() string {
+	return fmt.Sprintf("invalid config %s:\n  %s", e.file, strings.Join(e.problems, "\n  "))
+}
+
+type batchError struct {
+	data   string
+	chunk  int
+	chunks int
+	first  int
+	last   int
+	err    error
+}
+
+func newBatchError(data fixrDataDef, chunk int, chunks int, rows fixrBatch, err error) error {
+	name := data.name
+	if name == "" {
+		name = fmt.Sprintf("%s.%s", data.schema, data.table)
+	}
+	return &batchError{data: name, chunk: chunk + 1, chunks: chunks, first: rows.first + 1, last: rows.last, err: err}
+}
+
+func (e batchError) Error() string {
+	return fmt.Sprintf("%s rows %d-%d (insert %d of %d): %s", e.data, e.first, e.last, e.chunk, e.chunks, e.err.Error())
+}
+
+func (e batchError) Unwrap() error {
+	return e.err
+}
+
+// strips the prefix from the query and message of a query error, if WithUnprefixedErrors was used
+func (f *Fixr) unprefixError(err error) error {
+	var dbErr *dbError
+	if f.unprefixErrors && errors.As(err, &dbErr) {
+		dbErr.unprefix = f.Prefixr()
+	}
+	return err
+}
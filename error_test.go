@@ -27,3 +27,30 @@ func (s *MySuite) Test_dbError_Error(c *C) {
 	err := newDbError(errors.New("this-is-my-error"), "this-is-my-query", []interface{}{"this", "are", "my", "parameters"})
 	c.Check(err.Error(), Equals, "this-is-my-error")
 }
+
+func (s *MySuite) Test_confError_Error(c *C) {
+	err := newConfError("test.config.json", []string{"this-is-a-problem", "this-is-another-problem"})
+	c.Check(err.Error(), Equals, "invalid config test.config.json:\n  this-is-a-problem\n  this-is-another-problem")
+}
+
+func (s *MySuite) Test_fixr_unprefixError(c *C) {
+	def := s.mock_templateDef()
+	conn := &mockDb{errs: map[int]error{1: errors.New("Error 1050: Table 'z_host_1_blog.users' already exists")}}
+	fixr := &Fixr{conn: conn, def: def, prefix: "z_host_1", clock: s.mock_now, unprefixErrors: true}
+
+	err := fixr.SetUp()
+	c.Check(err, ErrorMatches, "Error 1050: Table 'blog.users' already exists")
+
+	var queryErr QueryError
+	c.Assert(errors.As(err, &queryErr), Equals, true)
+	c.Check(queryErr.Query(), Equals, "create table blog.users (id int)")
+	c.Check(queryErr.Parameters(), HasLen, 0)
+
+	// without the option
+	conn.clear()
+	fixr.unprefixErrors = false
+	err = fixr.SetUp()
+	c.Check(err, ErrorMatches, "Error 1050: Table 'z_host_1_blog.users' already exists")
+	c.Assert(errors.As(err, &queryErr), Equals, true)
+	c.Check(queryErr.Query(), Equals, "create table z_host_1_blog.users (id int)")
+}
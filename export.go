@@ -0,0 +1,128 @@
+package fixrupr
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v2"
+)
+
+// the rows selected from a table
+type fixrTableRows struct {
+	columns []string
+	// nil values are NULLs
+	rows [][][]byte
+}
+
+// splits a "<schema>.<table>" name
+func splitTableName(name string) (schema, table string, err error) {
+	pieces := strings.SplitN(name, ".", 2)
+	if len(pieces) != 2 || pieces[0] == "" || pieces[1] == "" {
+		err = fmt.Errorf("table %q must be named <schema>.<table>", name)
+		return
+	}
+	return pieces[0], pieces[1], nil
+}
+
+// selects every row from a table
+// name: the table's logical name - "<schema>.<table>"
+// orderBy (optional): the columns to sort the rows by. without them, the rows come back in whatever order
+// the database returns them - usually primary key order.
+func (f *Fixr) selectRows(name string, orderBy []string) (selected *fixrTableRows, err error) {
+	schema, table, err := splitTableName(name)
+	if err != nil {
+		return
+	}
+
+	query := fmt.Sprintf("select * from `%s_%s`.`%s`", f.prefix, schema, table)
+	if len(orderBy) > 0 {
+		query = fmt.Sprintf("%s order by `%s`", query, strings.Join(orderBy, "`,`"))
+	}
+
+	rows, err := f.conn.Query(query)
+	if err != nil {
+		err = newDbError(err, query, []interface{}{})
+		return
+	}
+	defer rows.Close()
+
+	selected = &fixrTableRows{}
+	selected.columns, err = rows.Columns()
+	if err != nil {
+		return
+	}
+
+	for rows.Next() {
+		values := make([]interface{}, len(selected.columns))
+		dest := make([]interface{}, len(values))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+
+		err = rows.Scan(dest...)
+		if err != nil {
+			return
+		}
+
+		row := make([][]byte, len(values))
+		for i, value := range values {
+			row[i] = valueBytes(value)
+		}
+		selected.rows = append(selected.rows, row)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// converts a value scanned from the database into the bytes mysql would send in its text protocol
+func valueBytes(value interface{}) []byte {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return append([]byte{}, v...)
+	case string:
+		return []byte(v)
+	case time.Time:
+		return []byte(v.Format(defaultTimeFormat))
+	case bool:
+		if v {
+			return []byte("1")
+		}
+		return []byte("0")
+	default:
+		return []byte(fmt.Sprint(v))
+	}
+}
+
+// serializes rows in the data file format. values that aren't valid utf-8 are written as base64.
+// ignore: columns to leave out
+func (selected *fixrTableRows) marshalYAML(ignore map[string]bool) ([]byte, error) {
+	rows := []yaml.MapSlice{}
+	for _, row := range selected.rows {
+		item := yaml.MapSlice{}
+		for i, column := range selected.columns {
+			if ignore[column] {
+				continue
+			}
+
+			var value interface{}
+			switch {
+			case row[i] == nil:
+				value = nil
+			case utf8.Valid(row[i]):
+				value = string(row[i])
+			default:
+				value = yaml.MapSlice{{Key: "base64", Value: base64.StdEncoding.EncodeToString(row[i])}}
+			}
+			item = append(item, yaml.MapItem{Key: column, Value: value})
+		}
+		rows = append(rows, item)
+	}
+
+	return yaml.Marshal(rows)
+}
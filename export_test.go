@@ -0,0 +1,45 @@
+package fixrupr
+
+import (
+	"database/sql/driver"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) Test_fixr_selectRows(c *C) {
+	conn := &mockDb{
+		columns: []string{"id", "comment", "posted"},
+		results: [][]driver.Value{
+			{int64(1), []byte("cool!"), time.Date(2015, 3, 15, 12, 30, 0, 0, time.UTC)},
+			{int64(2), []byte(""), nil},
+		},
+	}
+	fixr := &Fixr{conn: conn, prefix: "v_test"}
+
+	selected, err := fixr.selectRows("blog.comments", nil)
+	c.Assert(err, IsNil)
+	c.Check(conn.queries, DeepEquals, []string{"select * from `v_test_blog`.`comments`"})
+	c.Check(selected.columns, DeepEquals, []string{"id", "comment", "posted"})
+	c.Check(selected.rows, DeepEquals, [][][]byte{
+		{[]byte("1"), []byte("cool!"), []byte("2015-03-15 12:30:00")},
+		{[]byte("2"), []byte{}, nil},
+	})
+
+	conn.clear()
+	_, err = fixr.selectRows("blog.comments", []string{"posted", "id"})
+	c.Assert(err, IsNil)
+	c.Check(conn.queries, DeepEquals, []string{"select * from `v_test_blog`.`comments` order by `posted`,`id`"})
+
+	_, err = fixr.selectRows("comments", nil)
+	c.Check(err, ErrorMatches, "table \"comments\" must be named <schema>.<table>")
+}
+
+func (s *MySuite) Test_valueBytes(c *C) {
+	c.Check(valueBytes(nil), IsNil)
+	c.Check(valueBytes([]byte{}), DeepEquals, []byte{})
+	c.Check(valueBytes("abc"), DeepEquals, []byte("abc"))
+	c.Check(valueBytes(int64(-4)), DeepEquals, []byte("-4"))
+	c.Check(valueBytes(1.5), DeepEquals, []byte("1.5"))
+	c.Check(valueBytes(true), DeepEquals, []byte("1"))
+}
@@ -8,21 +8,88 @@ import (
 	"os"
 	"regexp"
 	"time"
+
+	"github.com/verkestk/fixrupr/prefixr"
 )
 
 // Fixr does all the db setup and teardown.
 type Fixr struct {
 	conn       fixrConn
 	def        *fixrDef
+	active     *fixrDef
+	path       string
 	prefix     string
 	schemaName string
+	clock      func() time.Time
+	now        time.Time
+	vars       map[string]string
+
+	updateSnapshots bool
+	template        bool
+	cache           bool
+	maxParams       int
+	maxBytes        int
+	bulkLoad        bool
+	bulkUnsupported int32 // set with atomic - data files can be loaded in parallel
+	parallelism     int
+	unprefixErrors  bool
+}
+
+// Option configures optional Fixr behavior. Pass options to New.
+type Option func(*Fixr)
+
+// WithClock sets the clock used to evaluate relative time cells (like {now: "-3d"}). The clock is read
+// once per SetUp. Defaults to time.Now.
+func WithClock(clock func() time.Time) Option {
+	return func(f *Fixr) {
+		f.clock = clock
+	}
+}
+
+// WithVars sets the values of ${VAR} references in the config file, DDL files, and data cells. Variables
+// that aren't in vars are looked up in the environment.
+func WithVars(vars map[string]string) Option {
+	return func(f *Fixr) {
+		f.vars = vars
+	}
+}
+
+// WithPrefix sets the prefix of the schema names instead of generating one from the hostname and time.
+// The prefix must be a valid unquoted mysql identifier, and short enough that the prefixed schema names
+// fit in 64 characters.
+func WithPrefix(prefix string) Option {
+	return func(f *Fixr) {
+		f.prefix = prefix
+	}
+}
+
+// WithUnprefixedErrors strips the prefix from the schema names in the messages and queries of the
+// errors SetUp, SetUpProfile, Reset, and TearDown return - `z_host_1697000000_blog` becomes `blog`. That
+// keeps errors readable, and the same from run to run.
+func WithUnprefixedErrors() Option {
+	return func(f *Fixr) {
+		f.unprefixErrors = true
+	}
 }
 
 // New gets a new Fixr instance
 // conn: db connection
 // configPath: path to the directory containing the config file and the schema/data directories
 // schemaName (optional): schema to track set-ups/tear-downs
-func New(conn *sql.DB, configPath string, schemaName string) (f *Fixr, err error) {
+// opts (optional): additional configuration
+func New(conn *sql.DB, configPath string, schemaName string, opts ...Option) (f *Fixr, err error) {
+	fixr := &Fixr{
+		conn:       conn,
+		prefix:     getPrefix(),
+		schemaName: schemaName,
+		clock:      time.Now,
+	}
+
+	// options come first - some of them affect how the config is loaded
+	for _, opt := range opts {
+		opt(fixr)
+	}
+
 	// parse config file
 	var (
 		conf = &fixrConf{}
@@ -30,11 +97,22 @@ func New(conn *sql.DB, configPath string, schemaName string) (f *Fixr, err error
 	)
 
 	// get the file contents & parse
-	conf, err = loadConfig(fmt.Sprintf("%s/test.config.json", configPath))
+	filename, err := findConfig(configPath)
+	if err != nil {
+		return
+	}
+
+	conf, err = loadConfig(filename)
 	if err != nil {
 		return
 	}
 	conf.path = configPath
+	conf.vars = fixr.vars
+
+	if fixr.cache && fixr.schemaName == "" {
+		err = fmt.Errorf("WithCache needs a tracking schema")
+		return
+	}
 
 	// validate and load the config data
 	def, err = conf.load()
@@ -42,12 +120,9 @@ func New(conn *sql.DB, configPath string, schemaName string) (f *Fixr, err error
 		return
 	}
 
-	f = &Fixr{
-		conn:       conn,
-		def:        def,
-		prefix:     getPrefix(),
-		schemaName: schemaName,
-	}
+	fixr.def = def
+	fixr.path = configPath
+	f = fixr
 
 	return
 }
@@ -55,6 +130,36 @@ func New(conn *sql.DB, configPath string, schemaName string) (f *Fixr, err error
 // SetUp sets up the database(s) - creates schemas, tables, and functions and
 // inserts rows.
 func (f *Fixr) SetUp() (err error) {
+	f.active = f.def
+	return f.unprefixError(f.setUp())
+}
+
+// SetUpProfile sets up the database(s) for a profile declared in the config - creates the profile's
+// schemas (or all of them, if the profile doesn't list any) and inserts the profile's data.
+func (f *Fixr) SetUpProfile(name string) (err error) {
+	f.active, err = f.def.profile(name)
+	if err != nil {
+		return
+	}
+	return f.unprefixError(f.setUp())
+}
+
+func (f *Fixr) setUp() (err error) {
+	// relative time cells are all evaluated against the same time
+	f.now = f.clock()
+
+	if f.cache {
+		return f.setUpCached()
+	}
+	return f.build()
+}
+
+// creates the schemas and inserts the rows - from the template, if there is one
+func (f *Fixr) build() (err error) {
+	if f.template {
+		return f.setUpFromTemplate()
+	}
+
 	// create schema
 	err = f.create()
 	if err != nil {
@@ -66,11 +171,32 @@ func (f *Fixr) SetUp() (err error) {
 	return
 }
 
-// TearDown tears down the database(s) - drops the databases created in SetUp.
+// Reset deletes every row from the tables created in SetUp or SetUpProfile and inserts the data again.
+// It's a cheaper way to isolate tests than tearing down and setting up again, since the schemas and
+// tables aren't recreated. Relative time cells are evaluated again.
+func (f *Fixr) Reset() (err error) {
+	f.now = f.clock()
+
+	err = f.clear()
+	if err == nil {
+		err = f.insert()
+	}
+	return f.unprefixError(err)
+}
+
+// TearDown tears down the database(s) - drops the databases created in SetUp or SetUpProfile.
 func (f *Fixr) TearDown() (err error) {
 	// drop schema
 	err = f.drop()
-	return
+	return f.unprefixError(err)
+}
+
+// the part of the config that was set up - the whole thing, unless a profile was used
+func (f *Fixr) activeDef() *fixrDef {
+	if f.active != nil {
+		return f.active
+	}
+	return f.def
 }
 
 // GetPrefix returns the prefix used - useful for making queries between SetUp and TearDown
@@ -78,6 +204,26 @@ func (f *Fixr) GetPrefix() string {
 	return f.prefix
 }
 
+// Schemas returns the names of the schemas created in SetUp or SetUpProfile - logical names (from the
+// config) to physical names (with the prefix). It can be used as the Names of a prefixr.Mapper.
+func (f *Fixr) Schemas() map[string]string {
+	schemas := map[string]string{}
+	for _, schema := range f.activeDef().schemas {
+		schemas[schema.name] = fmt.Sprintf("%s_%s", f.prefix, schema.name)
+	}
+	return schemas
+}
+
+// Prefixr returns a prefixr.Prefixr for the schemas created in SetUp or SetUpProfile - with the prefix
+// and the logical schema names. Set Qualified to rewrite queries that don't use placeholders.
+func (f *Fixr) Prefixr() *prefixr.Prefixr {
+	schemas := []string{}
+	for _, schema := range f.activeDef().schemas {
+		schemas = append(schemas, schema.name)
+	}
+	return &prefixr.Prefixr{PrefixString: f.prefix, Schemas: schemas}
+}
+
 func getPrefix() string {
 	host, err := os.Hostname()
 	if err != nil {
@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
 	. "gopkg.in/check.v1"
 )
@@ -51,6 +52,84 @@ func (s *MySuite) Test_fixr_SetUp(c *C) {
 	c.Check(err, IsNil)
 }
 
+func (s *MySuite) Test_fixr_SetUp_clock(c *C) {
+	configPath := s.help_mockFiles(c)
+	now := time.Date(2015, 3, 15, 12, 30, 0, 0, time.UTC)
+	f, err := New(nil, configPath, "", WithClock(func() time.Time { return now }))
+	c.Assert(f, NotNil)
+	c.Assert(err, IsNil)
+	f.conn = &mockDb{}
+
+	err = f.SetUp()
+	c.Check(err, IsNil)
+	c.Check(f.now, Equals, now)
+}
+
+func (s *MySuite) Test_fixr_SetUpProfile(c *C) {
+	configPath := s.help_mockFiles(c)
+	f, err := New(nil, configPath, "")
+	c.Assert(f, NotNil)
+	c.Assert(err, IsNil)
+	conn := &mockDb{}
+	f.conn = conn
+
+	err = f.SetUpProfile("minimal")
+	c.Check(err, IsNil)
+	c.Assert(conn.queries, HasLen, 7)
+	c.Check(conn.queries[0], Equals, fmt.Sprintf("create schema `%s_blog`", f.prefix))
+	c.Check(conn.queries[5], Matches, "select .* from information_schema.routines .*")
+	c.Check(conn.queries[6], Matches, fmt.Sprintf("insert into `%s_blog`.`users` .*", f.prefix))
+
+	conn.clear()
+	err = f.TearDown()
+	c.Check(err, IsNil)
+	c.Assert(conn.queries, HasLen, 1)
+	c.Check(conn.queries[0], Equals, fmt.Sprintf("drop schema `%s_blog`", f.prefix))
+
+	err = f.SetUpProfile("nope")
+	c.Check(err, ErrorMatches, "unknown profile \"nope\"")
+}
+
+func (s *MySuite) Test_fixr_Schemas(c *C) {
+	configPath := s.help_mockFiles(c)
+	f, err := New(nil, configPath, "", WithPrefix("z_test"))
+	c.Assert(err, IsNil)
+	f.conn = &mockDb{}
+
+	c.Check(f.Schemas(), DeepEquals, map[string]string{"blog": "z_test_blog", "reporting": "z_test_reporting"})
+
+	err = f.SetUpProfile("minimal")
+	c.Assert(err, IsNil)
+	c.Check(f.Schemas(), DeepEquals, map[string]string{"blog": "z_test_blog"})
+
+	p := f.Prefixr()
+	c.Check(p.PrefixString, Equals, "z_test")
+	c.Check(p.Schemas, DeepEquals, []string{"blog"})
+}
+
+func (s *MySuite) Test_fixr_Reset(c *C) {
+	configPath := s.help_mockFiles(c)
+	f, err := New(nil, configPath, "")
+	c.Assert(f, NotNil)
+	c.Assert(err, IsNil)
+	conn := &mockDb{}
+	f.conn = conn
+
+	err = f.SetUpProfile("minimal")
+	c.Assert(err, IsNil)
+	conn.clear()
+
+	err = f.Reset()
+	c.Check(err, IsNil)
+	c.Assert(conn.queries, HasLen, 6)
+	c.Check(conn.queries[0], Equals, "set foreign_key_checks = 0")
+	c.Check(conn.queries[1], Equals, fmt.Sprintf("truncate table `%s_blog`.`comments`", f.prefix))
+	c.Check(conn.queries[2], Equals, fmt.Sprintf("truncate table `%s_blog`.`articles`", f.prefix))
+	c.Check(conn.queries[3], Equals, fmt.Sprintf("truncate table `%s_blog`.`users`", f.prefix))
+	c.Check(conn.queries[4], Equals, "set foreign_key_checks = 1")
+	c.Check(conn.queries[5], Matches, fmt.Sprintf("insert into `%s_blog`.`users` .*", f.prefix))
+}
+
 func (s *MySuite) Test_fixr_TearDown(c *C) {
 	configPath := s.help_mockFiles(c)
 	f, err := New(nil, configPath, "jamila")
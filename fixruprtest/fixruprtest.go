@@ -0,0 +1,108 @@
+// Package fixruprtest wires fixrupr into go tests. It takes care of the New, SetUp, and TearDown
+// boilerplate and gives every test its own uniquely prefixed schemas.
+package fixruprtest
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/verkestk/fixrupr"
+)
+
+// the longest test name that goes into a prefix. the prefix is stored in the tracking table's 32
+// character prefix column: "z_" + name + "_" + 8 random hex characters
+const maxNameLength = 19
+
+// the most of a subtest's own name that goes into a prefix - the end of it, which is where go puts the
+// #01 suffixes that tell subtests with the same name apart
+const maxSubtestLength = 8
+
+var (
+	profile = flag.String("fixrupr.profile", "", "fixrupr profile to set up instead of the full config")
+	update  = flag.Bool("fixrupr.update", false, "write fixrupr snapshots instead of comparing with them")
+
+	// characters that aren't allowed in an unquoted mysql identifier
+	unsafe = regexp.MustCompile("[^0-9a-zA-Z$_]")
+)
+
+// Setup creates a Fixr for the test and sets it up. The test fails immediately if either fails.
+// TearDown is registered with t.Cleanup, so the schemas are dropped when the test and its subtests
+// finish. The prefix is named after the test so leaked schemas can be traced back to it, and it's
+// unique, so Setup is safe to use from parallel tests.
+//
+// If the -fixrupr.profile flag is set, that profile is set up instead of the full config. If the
+// -fixrupr.update flag is set, Snapshot writes golden files instead of comparing with them.
+//
+// conn: db connection
+// configPath: path to the directory containing the config file and the schema/data directories
+// opts (optional): additional configuration - a WithPrefix option here overrides the generated prefix
+func Setup(t testing.TB, conn *sql.DB, configPath string, opts ...fixrupr.Option) *fixrupr.Fixr {
+	t.Helper()
+
+	opts = append([]fixrupr.Option{fixrupr.WithPrefix(Prefix(t)), fixrupr.WithSnapshotUpdate(*update)}, opts...)
+	f, err := fixrupr.New(conn, configPath, "", opts...)
+	if err != nil {
+		t.Fatalf("fixrupr: %s", err)
+	}
+
+	// registered before SetUp so that whatever a failed SetUp created is still cleaned up
+	t.Cleanup(func() {
+		err := f.TearDown()
+		if err != nil {
+			t.Errorf("fixrupr: tear down %s: %s", f.GetPrefix(), err)
+		}
+	})
+
+	if *profile != "" {
+		err = f.SetUpProfile(*profile)
+	} else {
+		err = f.SetUp()
+	}
+	if err != nil {
+		t.Fatalf("fixrupr: set up %s: %s", f.GetPrefix(), err)
+	}
+
+	return f
+}
+
+// Prefix generates a schema prefix for a test - the test's name, made safe for an unquoted mysql
+// identifier and shortened, followed by a random suffix. When a subtest's name has to be shortened, the
+// parent test's part is shortened first, so the prefix still says which subtest it was.
+func Prefix(t testing.TB) string {
+	name := prefixName(t.Name())
+
+	suffix := make([]byte, 4)
+	_, err := rand.Read(suffix)
+	if err != nil {
+		t.Fatalf("fixrupr: generating prefix: %s", err)
+	}
+
+	return fmt.Sprintf("z_%s_%s", name, hex.EncodeToString(suffix))
+}
+
+// shortens a test name for a prefix, keeping the end of the last path element
+func prefixName(testName string) string {
+	name := unsafe.ReplaceAllString(testName, "_")
+	i := strings.LastIndex(testName, "/")
+	if len(name) <= maxNameLength || i < 0 {
+		if len(name) > maxNameLength {
+			name = name[0:maxNameLength]
+		}
+		return name
+	}
+
+	parent, last := unsafe.ReplaceAllString(testName[:i], "_"), unsafe.ReplaceAllString(testName[i+1:], "_")
+	if len(last) > maxSubtestLength {
+		last = last[len(last)-maxSubtestLength:]
+	}
+	if len(parent) > maxNameLength-len(last)-1 {
+		parent = parent[0 : maxNameLength-len(last)-1]
+	}
+	return parent + "_" + last
+}
@@ -0,0 +1,147 @@
+package fixruprtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// records the statements executed through it
+type mockDriver struct {
+	mutex   sync.Mutex
+	queries []string
+}
+
+type mockConn struct {
+	driver *mockDriver
+}
+
+func (d *mockDriver) Open(name string) (driver.Conn, error) {
+	return &mockConn{driver: d}, nil
+}
+
+func (d *mockDriver) executed() []string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return append([]string{}, d.queries...)
+}
+
+func (c *mockConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("prepare isn't supported")
+}
+
+func (c *mockConn) Close() error {
+	return nil
+}
+
+func (c *mockConn) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("transactions aren't supported")
+}
+
+func (c *mockConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.driver.mutex.Lock()
+	defer c.driver.mutex.Unlock()
+	c.driver.queries = append(c.driver.queries, query)
+	return driver.RowsAffected(0), nil
+}
+
+var mock = &mockDriver{}
+
+func init() {
+	sql.Register("fixruprtest-mock", mock)
+}
+
+func help_mockFiles(t testing.TB) (dir string) {
+	dir = t.TempDir()
+	os.MkdirAll(fmt.Sprintf("%s/schema/blog/tables", dir), 0755)
+	os.MkdirAll(fmt.Sprintf("%s/data", dir), 0755)
+
+	ioutil.WriteFile(fmt.Sprintf("%s/test.config.json", dir), []byte(`{"schemas": [{"name": "blog", "tables": ["users"]}], "data": ["blog.users"]}`), 0755)
+	ioutil.WriteFile(fmt.Sprintf("%s/schema/blog/tables/users.sql", dir), []byte("create table {{schema}}.users (id int)"), 0755)
+	ioutil.WriteFile(fmt.Sprintf("%s/data/blog.users.yml", dir), []byte("- id: 1\n"), 0755)
+	return
+}
+
+func TestPrefix_name(t *testing.T) {
+	// the parent test's name is shortened first, so the subtest's name survives
+	expected := map[string]string{"a/b c#01": "z_TestPrefix_n_b_c_01_", "this-is-a-very-long-subtest-name": "z_TestPrefix_est_name_"}
+	for name, start := range expected {
+		start := start
+		t.Run(name, func(t *testing.T) {
+			prefix := Prefix(t)
+			if len(prefix) > 32 {
+				t.Errorf("prefix %s is longer than 32 characters", prefix)
+			}
+			if !strings.HasPrefix(prefix, start) {
+				t.Errorf("prefix %s doesn't start with %s", prefix, start)
+			}
+			if strings.ContainsAny(prefix[2:], "/ #-") {
+				t.Errorf("prefix %s isn't a safe identifier", prefix)
+			}
+			if Prefix(t) == prefix {
+				t.Errorf("prefix %s isn't unique", prefix)
+			}
+		})
+	}
+
+	// short names are kept as they are
+	if name := prefixName("TestPrefix/a"); name != "TestPrefix_a" {
+		t.Errorf("unexpected name %s", name)
+	}
+	if name := prefixName("TestPrefix_name_that_is_too_long"); name != "TestPrefix_name_tha" {
+		t.Errorf("unexpected name %s", name)
+	}
+}
+
+func TestSetup(t *testing.T) {
+	conn, err := sql.Open("fixruprtest-mock", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := help_mockFiles(t)
+
+	// the mock driver is shared - only this run's queries count
+	before := len(mock.executed())
+	var prefix string
+	t.Run("parallel", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			i := i
+			t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+				t.Parallel()
+				f := Setup(t, conn, dir)
+				if !strings.HasPrefix(f.GetPrefix(), fmt.Sprintf("z_TestSetup_paralle_%d_", i)) {
+					t.Errorf("unexpected prefix %s", f.GetPrefix())
+				}
+				if i == 0 {
+					prefix = f.GetPrefix()
+				}
+			})
+		}
+	})
+
+	queries := mock.executed()[before:]
+	expected := []string{
+		fmt.Sprintf("create schema `%s_blog`", prefix),
+		fmt.Sprintf("create table %s_blog.users (id int)", prefix),
+		fmt.Sprintf("insert into `%s_blog`.`users` (`id`) VALUES (?)", prefix),
+		fmt.Sprintf("drop schema `%s_blog`", prefix),
+	}
+	for _, e := range expected {
+		found := false
+		for _, q := range queries {
+			found = found || q == e
+		}
+		if !found {
+			t.Errorf("expected %q to be executed", e)
+		}
+	}
+	if len(queries) != 12 {
+		t.Errorf("expected 12 queries, got %d", len(queries))
+	}
+}
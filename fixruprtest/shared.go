@@ -0,0 +1,142 @@
+package fixruprtest
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/verkestk/fixrupr"
+)
+
+// Shared is a set of fixtures shared by all the tests in a package. The schemas are set up once in
+// TestMain, and tests call Reset to get a fresh copy of the data. The zero value is ready to use:
+//
+//	var fixtures = &fixruprtest.Shared{}
+//
+//	func TestMain(m *testing.M) {
+//		os.Exit(fixtures.Run(m, conn, "./test-data"))
+//	}
+//
+// Tests that call Reset share schemas with every other test in the package, so they shouldn't be run
+// with t.Parallel().
+type Shared struct {
+	fixr     *fixrupr.Fixr
+	tearDown sync.Once
+}
+
+// Run sets up the fixtures, runs the tests, and tears the fixtures down. It returns the exit code to pass
+// to os.Exit. The fixtures are also torn down if TestMain panics or the test binary is interrupted
+// (SIGINT or SIGTERM). A panic inside a test kills the test binary before Run gets control back, so
+// those schemas are left behind - the tracking schema shows which ones.
+//
+// If the -fixrupr.profile flag is set, that profile is set up instead of the full config. If the
+// -fixrupr.update flag is set, Snapshot writes golden files instead of comparing with them.
+//
+// conn: db connection
+// configPath: path to the directory containing the config file and the schema/data directories
+// opts (optional): additional configuration
+func (s *Shared) Run(m *testing.M, conn *sql.DB, configPath string, opts ...fixrupr.Option) (code int) {
+	// flags have to be parsed before the profile flag can be read - m.Run would do it later anyway
+	if !flag.Parsed() {
+		flag.Parse()
+	}
+
+	var err error
+	opts = append([]fixrupr.Option{fixrupr.WithSnapshotUpdate(*update)}, opts...)
+	s.fixr, err = fixrupr.New(conn, configPath, "", opts...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fixrupr: %s\n", err)
+		return 1
+	}
+
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer func() {
+		signal.Stop(signals)
+		close(done)
+	}()
+	go func() {
+		select {
+		case sig := <-signals:
+			fmt.Fprintf(os.Stderr, "fixrupr: %s - tearing down %s\n", sig, s.fixr.GetPrefix())
+			s.TearDown()
+			os.Exit(1)
+		case <-done:
+		}
+	}()
+
+	defer func() {
+		if r := recover(); r != nil {
+			s.TearDown()
+			panic(r)
+		}
+	}()
+
+	if *profile != "" {
+		err = s.fixr.SetUpProfile(*profile)
+	} else {
+		err = s.fixr.SetUp()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fixrupr: set up %s: %s\n", s.fixr.GetPrefix(), err)
+		s.TearDown()
+		return 1
+	}
+
+	code = m.Run()
+
+	if !s.TearDown() && code == 0 {
+		code = 1
+	}
+	return
+}
+
+// TearDown tears down the fixtures. Run calls it - it's only needed when something else controls the
+// lifetime of the test binary. It's safe to call more than once, but only the first call does anything.
+// Returns false if the tear down failed.
+func (s *Shared) TearDown() (ok bool) {
+	ok = true
+	s.tearDown.Do(func() {
+		if s.fixr == nil {
+			return
+		}
+
+		err := s.fixr.TearDown()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "fixrupr: tear down %s: %s\n", s.fixr.GetPrefix(), err)
+			ok = false
+		}
+	})
+	return
+}
+
+// Reset deletes every row from the shared tables and inserts the data again, so the test starts with
+// the data from the data files. The test fails immediately if the reset fails.
+func (s *Shared) Reset(t testing.TB) {
+	t.Helper()
+
+	if s.fixr == nil {
+		t.Fatalf("fixrupr: Reset called before Run")
+	}
+
+	err := s.fixr.Reset()
+	if err != nil {
+		t.Fatalf("fixrupr: reset %s: %s", s.fixr.GetPrefix(), err)
+	}
+}
+
+// Fixr gets the shared Fixr. It's nil until Run is called.
+func (s *Shared) Fixr() *fixrupr.Fixr {
+	return s.fixr
+}
+
+// Prefix gets the prefix of the shared schemas.
+func (s *Shared) Prefix() string {
+	return s.fixr.GetPrefix()
+}
@@ -0,0 +1,94 @@
+package fixruprtest
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/verkestk/fixrupr"
+)
+
+func TestShared(t *testing.T) {
+	conn, err := sql.Open("fixruprtest-mock", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := help_mockFiles(t)
+
+	s := &Shared{}
+	s.fixr, err = fixrupr.New(conn, dir, "", fixrupr.WithPrefix("z_TestShared"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.fixr.SetUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Prefix() != "z_TestShared" {
+		t.Errorf("unexpected prefix %s", s.Prefix())
+	}
+	if s.Fixr() != s.fixr {
+		t.Errorf("unexpected Fixr")
+	}
+
+	before := len(mock.executed())
+	s.Reset(t)
+	queries := mock.executed()[before:]
+	expected := []string{
+		"set foreign_key_checks = 0",
+		"truncate table `z_TestShared_blog`.`users`",
+		"set foreign_key_checks = 1",
+		"insert into `z_TestShared_blog`.`users` (`id`) VALUES (?)",
+	}
+	if fmt.Sprint(queries) != fmt.Sprint(expected) {
+		t.Errorf("expected %q, got %q", expected, queries)
+	}
+
+	// only the first tear down drops the schemas
+	before = len(mock.executed())
+	if !s.TearDown() || !s.TearDown() {
+		t.Errorf("tear down failed")
+	}
+	queries = mock.executed()[before:]
+	expected = []string{"drop schema `z_TestShared_blog`"}
+	if fmt.Sprint(queries) != fmt.Sprint(expected) {
+		t.Errorf("expected %q, got %q", expected, queries)
+	}
+}
+
+func TestShared_Run_panic(t *testing.T) {
+	conn, err := sql.Open("fixruprtest-mock", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := help_mockFiles(t)
+
+	// a nil testing.M panics as soon as Run hands over to it, after the schemas are set up
+	s := &Shared{}
+	before := len(mock.executed())
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Errorf("expected Run to pass the panic on")
+			}
+		}()
+		s.Run(nil, conn, dir, fixrupr.WithPrefix("z_TestShared_panic"))
+	}()
+
+	queries := mock.executed()[before:]
+	expected := []string{
+		"create schema `z_TestShared_panic_blog`",
+		"create table z_TestShared_panic_blog.users (id int)",
+		"insert into `z_TestShared_panic_blog`.`users` (`id`) VALUES (?)",
+		"drop schema `z_TestShared_panic_blog`",
+	}
+	if fmt.Sprint(queries) != fmt.Sprint(expected) {
+		t.Errorf("expected %q, got %q", expected, queries)
+	}
+
+	// the tear down already happened
+	before = len(mock.executed())
+	if !s.TearDown() || len(mock.executed()) != before {
+		t.Errorf("expected the second tear down to do nothing")
+	}
+}
@@ -0,0 +1,10 @@
+module github.com/verkestk/fixrupr
+
+go 1.18
+
+require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/go-sql-driver/mysql v1.7.1
+	gopkg.in/check.v1 v0.0.0-20161208181325-20d25e280405
+	gopkg.in/yaml.v2 v2.4.0
+)
@@ -0,0 +1,74 @@
+package fixrupr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+)
+
+// hashes the schemas, tables, and functions - everything that goes into creating the schemas
+func (def *fixrDef) ddlHash() string {
+	h := sha256.New()
+	for _, schema := range def.schemas {
+		fmt.Fprintf(h, "schema %q\n", schema.name)
+		for _, table := range schema.tables {
+			fmt.Fprintf(h, "table %q %q\n", table.name, table.ddl)
+			hashVars(h, table.vars)
+		}
+		for _, function := range schema.functions {
+			fmt.Fprintf(h, "function %q %q\n", function.name, function.ddl)
+			hashVars(h, function.vars)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// hashes the variables a ddl template uses, in sorted order
+func hashVars(h hash.Hash, vars map[string]string) {
+	names := []string{}
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(h, "var %q %q\n", name, vars[name])
+	}
+}
+
+// hashes the data - everything that goes into inserting the rows
+func (def *fixrDef) dataHash() string {
+	h := sha256.New()
+	for _, data := range def.data {
+		fmt.Fprintf(h, "data %q\n", data.name)
+		for _, row := range data.rows {
+			io.WriteString(h, "row\n")
+			hashRow(h, row)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// hashes the schemas, tables, functions, and data
+func (def *fixrDef) hash() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n", def.ddlHash(), def.dataHash())
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// rows are maps - the fields are hashed in sorted order so the hash is stable
+func hashRow(h hash.Hash, row map[string]fixrCellDef) {
+	fields := []string{}
+	for field := range row {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		cellDef := row[field]
+		fmt.Fprintf(h, "%q %t %t %q %q %t %q %q %t %x\n", field, cellDef.isParameter, cellDef.notNil, cellDef.value, cellDef.column,
+			cellDef.isTime, cellDef.timeExpr, cellDef.timeFormat, cellDef.isBinary, cellDef.binary)
+	}
+}
@@ -0,0 +1,211 @@
+package fixrupr
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/verkestk/fixrupr/prefixr"
+)
+
+// foreign key references in rendered DDL - "references users" and "references `blog`.`users`"
+var referencesPattern = regexp.MustCompile("(?i)\\breferences\\s+(`[^`]+`|[\\w$]+)(?:\\s*\\.\\s*(`[^`]+`|[\\w$]+))?")
+
+// the prefix DDL is rendered with to find the schemas it uses - the physical names are easy to spot
+const dependencyPrefix = "fixrupr_deps"
+
+// WithParallelism sets how many schemas are created, and how many data files are loaded, at once. Schemas
+// are created in parallel unless one references another's tables in a foreign key. Data files are loaded
+// in parallel unless they're for the same table or for tables related by a foreign key - those keep the
+// config order. Data files with param: false cells wait for everything before them, since their sql
+// could read any table.
+//
+// Dependencies are found in the rendered DDL - a schema waits for the earlier schemas its tables, views,
+// and functions use qualified names from, and tables are related through "references" clauses.
+// Relationships through triggers, or through functions the data doesn't name, aren't found. If a set up
+// fails, the error is the one from the first schema or data file (in config order) that failed. Defaults
+// to 1 - everything in order.
+func WithParallelism(n int) Option {
+	return func(f *Fixr) {
+		f.parallelism = n
+	}
+}
+
+// something to run in parallel
+type fixrTask struct {
+	// indexes of the earlier tasks that have to finish first
+	deps []int
+	run  func() error
+}
+
+// runs tasks on up to n at a time. a task starts when the tasks it depends on have finished, and is
+// skipped if any of them failed or were skipped. returns the error of the first task that failed, so
+// the error doesn't depend on timing.
+func runTasks(n int, tasks []fixrTask) error {
+	var (
+		errs    = make([]error, len(tasks))
+		skipped = make([]bool, len(tasks))
+		done    = make([]chan struct{}, len(tasks))
+		workers = make(chan struct{}, n)
+		wg      sync.WaitGroup
+	)
+
+	for i := range tasks {
+		done[i] = make(chan struct{})
+	}
+
+	for i, task := range tasks {
+		wg.Add(1)
+		go func(i int, task fixrTask) {
+			defer wg.Done()
+			defer close(done[i])
+
+			for _, dep := range task.deps {
+				<-done[dep]
+				if errs[dep] != nil || skipped[dep] {
+					skipped[i] = true
+					return
+				}
+			}
+
+			workers <- struct{}{}
+			errs[i] = task.run()
+			<-workers
+		}(i, task)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// creates the schemas - several at a time
+func (f *Fixr) createParallel() error {
+	schemas := f.activeDef().schemas
+
+	tasks := []fixrTask{}
+	for i, schema := range schemas {
+		schema := schema
+		task := fixrTask{run: func() error { return f.createSchema(schema) }}
+
+		// earlier schemas this one's tables, views, and functions use
+		uses := f.schemaDependencies(schema)
+		for j := 0; j < i; j++ {
+			if uses[schemas[j].name] {
+				task.deps = append(task.deps, j)
+			}
+		}
+		tasks = append(tasks, task)
+	}
+
+	return runTasks(f.parallelism, tasks)
+}
+
+// inserts the rows - several data files at a time
+func (f *Fixr) insertParallel() error {
+	data := f.activeDef().data
+	references := f.references()
+
+	tasks := []fixrTask{}
+	for i, d := range data {
+		d := d
+		task := fixrTask{run: func() error { return f.load(f.prefix, d) }}
+
+		raw := hasRawCells(d)
+		table := d.schema + "." + d.table
+		for j := 0; j < i; j++ {
+			other := data[j].schema + "." + data[j].table
+			if raw || other == table || contains(references[table], other) || contains(references[other], table) {
+				task.deps = append(task.deps, j)
+			}
+		}
+		tasks = append(tasks, task)
+	}
+
+	return runTasks(f.parallelism, tasks)
+}
+
+// renders a table or function's ddl with dependencyPrefix. ddl that doesn't render has no dependencies
+// - creating it reports the error.
+func (f *Fixr) dependencyDDL(schema string, ddl fixrDDLDef) string {
+	deps := *f
+	deps.prefix = dependencyPrefix
+	query, err := deps.renderDDL(schema, ddl)
+	if err != nil {
+		return ""
+	}
+	return query
+}
+
+// gets the logical name of a schema from a name in rendered ddl - a physical name, or a logical one
+// that wasn't prefixed
+func (f *Fixr) dependencySchema(name string) (logical string, ok bool) {
+	logical = strings.TrimPrefix(unquoteIdentifier(name), dependencyPrefix+"_")
+	return logical, f.isSchema(logical)
+}
+
+// gets the other schemas a schema's tables, views, and functions use qualified names from - through
+// {{schema "name"}}, {{pf:name}}, or by name
+func (f *Fixr) schemaDependencies(schema fixrSchemaDef) map[string]bool {
+	uses := map[string]bool{}
+	ddls := append(append([]fixrDDLDef{}, schema.tables...), schema.functions...)
+	for _, ddl := range ddls {
+		for _, qualifier := range prefixr.Compile(f.dependencyDDL(schema.name, ddl)).Qualifiers() {
+			if logical, ok := f.dependencySchema(qualifier); ok && logical != schema.name {
+				uses[logical] = true
+			}
+		}
+	}
+	return uses
+}
+
+// gets the tables ("<schema>.<table>") each table references in a foreign key
+func (f *Fixr) references() map[string][]string {
+	references := map[string][]string{}
+	for _, schema := range f.activeDef().schemas {
+		for _, table := range schema.tables {
+			name := schema.name + "." + table.name
+			for _, match := range referencesPattern.FindAllStringSubmatch(f.dependencyDDL(schema.name, table), -1) {
+				qualifier, referenced := match[1], unquoteIdentifier(match[2])
+				if referenced == "" {
+					qualifier, referenced = schema.name, unquoteIdentifier(qualifier)
+				} else if logical, ok := f.dependencySchema(qualifier); ok {
+					qualifier = logical
+				} else {
+					qualifier = unquoteIdentifier(qualifier)
+				}
+				references[name] = append(references[name], qualifier+"."+referenced)
+			}
+		}
+	}
+	return references
+}
+
+// checks whether a data file has param: false cells
+func hasRawCells(data fixrDataDef) bool {
+	for _, row := range data.rows {
+		for _, cellDef := range row {
+			if cellDef.notNil && !cellDef.isParameter && !cellDef.isTime && !cellDef.isBinary {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func unquoteIdentifier(identifier string) string {
+	return strings.Trim(identifier, "`")
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
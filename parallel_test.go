@@ -0,0 +1,171 @@
+package fixrupr
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) Test_runTasks(c *C) {
+	var (
+		lock sync.Mutex
+		ran  []int
+	)
+	task := func(i int, err error, deps ...int) fixrTask {
+		return fixrTask{deps: deps, run: func() error {
+			// later tasks finish first, unless something makes them wait
+			time.Sleep(time.Duration(10-i) * time.Millisecond)
+			lock.Lock()
+			ran = append(ran, i)
+			lock.Unlock()
+			return err
+		}}
+	}
+
+	err := runTasks(3, []fixrTask{task(0, nil), task(1, nil), task(2, nil, 0), task(3, nil, 2)})
+	c.Check(err, IsNil)
+	c.Assert(ran, HasLen, 4)
+	c.Check(indexOf(ran, 0) < indexOf(ran, 2), Equals, true)
+	c.Check(indexOf(ran, 2) < indexOf(ran, 3), Equals, true)
+
+	// the first failed task's error, no matter which failed first. tasks that depend on a failed task
+	// are skipped, but the others still run.
+	ran = nil
+	err = runTasks(3, []fixrTask{
+		task(0, nil),
+		task(1, errors.New("one")),
+		task(2, nil, 1),
+		task(3, errors.New("three")),
+		task(4, nil, 0),
+	})
+	c.Check(err, ErrorMatches, "one")
+	sort.Ints(ran)
+	c.Check(ran, DeepEquals, []int{0, 1, 3, 4})
+}
+
+func (s *MySuite) Test_fixr_references(c *C) {
+	def := &fixrDef{schemas: []fixrSchemaDef{
+		{name: "blog", tables: []fixrDDLDef{
+			{name: "users", ddl: "create table {{schema}}.users (id int)"},
+			{name: "comments", ddl: "create table {{schema}}.comments (id int, user_id int references users (id), " +
+				"article_id int, foreign key (article_id) REFERENCES {{schema}}.`articles`(id))"},
+		}},
+		{name: "reporting", tables: []fixrDDLDef{
+			{name: "reports", ddl: "create table {{schema}}.reports (user_id int, foreign key (user_id) references `{{pf:blog}}`.users (id))"},
+			{name: "totals", ddl: "create table {{schema}}.totals (article_id int references {{pf:`blog`.`articles`}} (id))"},
+			{name: "summaries", ddl: "create table {{schema}}.summaries (user_id int references {{schema \"blog\"}}.users (id), " +
+				"article_id int references `{{schema \"blog\"}}`.`articles` (id), report_id int references {{schema}}.reports (id))"},
+			{name: "external", ddl: "create table {{schema}}.external (id int references shared.things (id))"},
+		}},
+	}}
+	fixr := &Fixr{def: def, prefix: "v_test"}
+
+	c.Check(fixr.references(), DeepEquals, map[string][]string{
+		"blog.comments":       {"blog.users", "blog.articles"},
+		"reporting.reports":   {"blog.users"},
+		"reporting.totals":    {"blog.articles"},
+		"reporting.summaries": {"blog.users", "blog.articles", "reporting.reports"},
+		"reporting.external":  {"shared.things"},
+	})
+}
+
+func (s *MySuite) Test_fixr_createParallel(c *C) {
+	def := &fixrDef{schemas: []fixrSchemaDef{
+		{name: "blog", tables: []fixrDDLDef{
+			{name: "users", ddl: "create table {{schema}}.users (id int)"},
+		}},
+		{name: "reporting", tables: []fixrDDLDef{
+			{name: "recent", ddl: "create view {{schema}}.recent as select u.id from {{schema \"blog\"}}.users u -- archive.users"},
+		}},
+		{name: "archive", functions: []fixrDDLDef{
+			{name: "count_users", ddl: "create function {{schema}}.count_users() returns int return (select count(*) from {{pf:blog.users}})"},
+		}},
+		{name: "stats", functions: []fixrDDLDef{
+			{name: "copy", ddl: "create procedure {{schema}}.copy() insert into reporting.totals select 'blog.users'"},
+		}},
+		{name: "misc", tables: []fixrDDLDef{
+			{name: "notes", ddl: "create table {{schema}}.notes (id int)"},
+		}},
+	}}
+	fixr := &Fixr{def: def, prefix: "v_test", parallelism: 4}
+
+	// views and functions depend on the schemas they use - in comments and strings doesn't count
+	c.Check(fixr.schemaDependencies(def.schemas[0]), DeepEquals, map[string]bool{})
+	c.Check(fixr.schemaDependencies(def.schemas[1]), DeepEquals, map[string]bool{"blog": true})
+	c.Check(fixr.schemaDependencies(def.schemas[2]), DeepEquals, map[string]bool{"blog": true})
+	c.Check(fixr.schemaDependencies(def.schemas[3]), DeepEquals, map[string]bool{"reporting": true})
+	c.Check(fixr.schemaDependencies(def.schemas[4]), DeepEquals, map[string]bool{})
+
+	conn := &mockDb{}
+	fixr.conn = conn
+	err := fixr.createParallel()
+	c.Assert(err, IsNil)
+	c.Assert(conn.queries, HasLen, 10)
+	users := indexOfQuery(conn.queries, "create table v_test_blog.users (id int)")
+	c.Check(users < indexOfQuery(conn.queries, "create schema `v_test_reporting`"), Equals, true)
+	c.Check(users < indexOfQuery(conn.queries, "create schema `v_test_archive`"), Equals, true)
+	c.Check(indexOfQuery(conn.queries, "create view v_test_reporting.recent as select u.id from v_test_blog.users u -- archive.users") <
+		indexOfQuery(conn.queries, "create schema `v_test_stats`"), Equals, true)
+}
+
+func (s *MySuite) Test_fixr_insertParallel(c *C) {
+	def := &fixrDef{
+		schemas: []fixrSchemaDef{
+			{name: "blog", tables: []fixrDDLDef{
+				{name: "users", ddl: "create table {{schema}}.users (id int)"},
+				{name: "comments", ddl: "create table {{schema}}.comments (user_id int references users (id))"},
+			}},
+			{name: "reporting", tables: []fixrDDLDef{
+				{name: "reports", ddl: "create table {{schema}}.reports (id int)"},
+			}},
+		},
+		data: []fixrDataDef{
+			{name: "blog.users", schema: "blog", table: "users", rows: []map[string]fixrCellDef{{"id": {notNil: true, isParameter: true, value: "1"}}}},
+			{name: "reporting.reports", schema: "reporting", table: "reports", rows: []map[string]fixrCellDef{{"id": {notNil: true, isParameter: true, value: "1"}}}},
+			{name: "blog.comments", schema: "blog", table: "comments", rows: []map[string]fixrCellDef{{"user_id": {notNil: true, isParameter: true, value: "1"}}}},
+		},
+	}
+
+	conn := &mockDb{}
+	fixr := &Fixr{conn: conn, def: def, prefix: "v_test", parallelism: 4}
+
+	err := fixr.create()
+	c.Check(err, IsNil)
+	c.Check(conn.queries, HasLen, 5)
+
+	conn.clear()
+	err = fixr.insert()
+	c.Check(err, IsNil)
+	c.Assert(conn.queries, HasLen, 3)
+	users := indexOfQuery(conn.queries, "insert into `v_test_blog`.`users` (`id`) VALUES (?)")
+	comments := indexOfQuery(conn.queries, "insert into `v_test_blog`.`comments` (`user_id`) VALUES (?)")
+	c.Check(users >= 0 && users < comments, Equals, true)
+
+	// the error from the first failed data file
+	conn = &mockDb{errs: map[int]error{0: errors.New("nope"), 1: errors.New("nope"), 2: errors.New("nope")}}
+	fixr.conn = conn
+	err = fixr.insert()
+	c.Check(err, ErrorMatches, "blog.users rows 1-1 .*")
+	c.Check(conn.queries, HasLen, 2)
+}
+
+func indexOf(values []int, value int) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
+
+func indexOfQuery(queries []string, query string) int {
+	for i, q := range queries {
+		if q == query {
+			return i
+		}
+	}
+	return -1
+}
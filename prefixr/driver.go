@@ -0,0 +1,178 @@
+package prefixr
+
+import (
+	"context"
+	"database/sql/driver"
+)
+
+// Rewriter rewrites queries before they're sent to the database. Prefixr is a Rewriter.
+type Rewriter interface {
+	Rewrite(query string) (string, error)
+}
+
+// Rewrite applies the prefix to a query - it makes Prefixr a Rewriter. In Strict mode, it returns the
+// same errors as PrefixE.
+func (p *Prefixr) Rewrite(query string) (string, error) {
+	return p.PrefixE(query)
+}
+
+// Driver wraps another database/sql driver and rewrites every query (including prepared statements)
+// before the wrapped driver sees it. Code can then use {{pf:name}} placeholders without calling Prefix -
+// tests register a Driver with their prefix, and production registers one with an empty prefix:
+//
+//	sql.Register("mysql-prefixed", &prefixr.Driver{Driver: &mysql.MySQLDriver{}, Rewriter: &prefixr.Prefixr{PrefixString: prefix}})
+//	db, err := sql.Open("mysql-prefixed", dsn)
+type Driver struct {
+	Driver   driver.Driver
+	Rewriter Rewriter
+}
+
+// Open opens a connection with the wrapped driver.
+func (d *Driver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &rewriteConn{conn: conn, rewriter: d.Rewriter}, nil
+}
+
+// OpenConnector gets a connector from the wrapped driver, if it has one.
+func (d *Driver) OpenConnector(name string) (driver.Connector, error) {
+	if driverContext, ok := d.Driver.(driver.DriverContext); ok {
+		connector, err := driverContext.OpenConnector(name)
+		if err != nil {
+			return nil, err
+		}
+		return NewConnector(connector, d.Rewriter), nil
+	}
+	return &dsnConnector{name: name, driver: d}, nil
+}
+
+// NewConnector wraps a connector so its connections rewrite every query. Use it with sql.OpenDB:
+//
+//	connector, err := mysql.NewConnector(config)
+//	db := sql.OpenDB(prefixr.NewConnector(connector, &prefixr.Prefixr{PrefixString: prefix}))
+func NewConnector(connector driver.Connector, rewriter Rewriter) driver.Connector {
+	return &rewriteConnector{connector: connector, rewriter: rewriter}
+}
+
+type rewriteConnector struct {
+	connector driver.Connector
+	rewriter  Rewriter
+}
+
+func (c *rewriteConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &rewriteConn{conn: conn, rewriter: c.rewriter}, nil
+}
+
+func (c *rewriteConnector) Driver() driver.Driver {
+	return &Driver{Driver: c.connector.Driver(), Rewriter: c.rewriter}
+}
+
+// a connector for drivers that don't have their own
+type dsnConnector struct {
+	name   string
+	driver *Driver
+}
+
+func (c *dsnConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.name)
+}
+
+func (c *dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// a connection that rewrites queries. everything else is passed through to the wrapped connection.
+type rewriteConn struct {
+	conn     driver.Conn
+	rewriter Rewriter
+}
+
+func (c *rewriteConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *rewriteConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	query, err := c.rewriter.Rewrite(query)
+	if err != nil {
+		return nil, err
+	}
+	if preparer, ok := c.conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.conn.Prepare(query)
+}
+
+func (c *rewriteConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.conn.(driver.ExecerContext)
+	if !ok {
+		// database/sql prepares the statement instead
+		return nil, driver.ErrSkip
+	}
+	query, err := c.rewriter.Rewrite(query)
+	if err != nil {
+		return nil, err
+	}
+	return execer.ExecContext(ctx, query, args)
+}
+
+func (c *rewriteConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.conn.(driver.QueryerContext)
+	if !ok {
+		// database/sql prepares the statement instead
+		return nil, driver.ErrSkip
+	}
+	query, err := c.rewriter.Rewrite(query)
+	if err != nil {
+		return nil, err
+	}
+	return queryer.QueryContext(ctx, query, args)
+}
+
+func (c *rewriteConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *rewriteConn) Begin() (driver.Tx, error) {
+	return c.conn.Begin()
+}
+
+func (c *rewriteConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.conn.Begin()
+}
+
+func (c *rewriteConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *rewriteConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *rewriteConn) IsValid() bool {
+	if validator, ok := c.conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func (c *rewriteConn) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := c.conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
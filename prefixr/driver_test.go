@@ -0,0 +1,159 @@
+package prefixr
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+
+	. "gopkg.in/check.v1"
+)
+
+// a driver that records the queries it gets
+type mockDriver struct {
+	lock    sync.Mutex
+	queries []string
+
+	// leave out ExecerContext and QueryerContext, so database/sql prepares everything
+	prepareOnly bool
+}
+
+type mockConn struct {
+	driver *mockDriver
+}
+
+type mockExecConn struct {
+	mockConn
+}
+
+type mockStmt struct {
+	driver *mockDriver
+}
+
+type mockRows struct{}
+
+func (d *mockDriver) record(query string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.queries = append(d.queries, query)
+}
+
+func (d *mockDriver) Open(name string) (driver.Conn, error) {
+	if d.prepareOnly {
+		return &mockConn{driver: d}, nil
+	}
+	return &mockExecConn{mockConn{driver: d}}, nil
+}
+
+func (c *mockConn) Prepare(query string) (driver.Stmt, error) {
+	c.driver.record("prepare " + query)
+	return &mockStmt{driver: c.driver}, nil
+}
+
+func (c *mockConn) Close() error {
+	return nil
+}
+
+func (c *mockConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions aren't supported")
+}
+
+func (c *mockExecConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.driver.record("exec " + query)
+	return driver.RowsAffected(1), nil
+}
+
+func (c *mockExecConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.driver.record("query " + query)
+	return &mockRows{}, nil
+}
+
+func (s *mockStmt) Close() error {
+	return nil
+}
+
+func (s *mockStmt) NumInput() int {
+	return -1
+}
+
+func (s *mockStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+
+func (s *mockStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &mockRows{}, nil
+}
+
+func (r *mockRows) Columns() []string {
+	return []string{"id"}
+}
+
+func (r *mockRows) Close() error {
+	return nil
+}
+
+func (r *mockRows) Next(dest []driver.Value) error {
+	return io.EOF
+}
+
+type failingRewriter struct{}
+
+func (r failingRewriter) Rewrite(query string) (string, error) {
+	return "", errors.New("can't rewrite")
+}
+
+// the driver behind the registered "prefixr-test" driver - sql.Register panics when a name is registered
+// twice, so it's only done once, however many times the tests run
+var registeredMock = &mockDriver{}
+
+func init() {
+	sql.Register("prefixr-test", &Driver{Driver: registeredMock, Rewriter: &Prefixr{PrefixString: "z_test"}})
+}
+
+func (s *MySuite) Test_Driver(c *C) {
+	mock := registeredMock
+	mock.lock.Lock()
+	mock.queries = nil
+	mock.lock.Unlock()
+
+	db, err := sql.Open("prefixr-test", "")
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	_, err = db.Exec("delete from {{pf:blog}}.users where id = ?", 1)
+	c.Check(err, IsNil)
+	rows, err := db.Query("select id from {{pf:blog}}.users")
+	c.Assert(err, IsNil)
+	rows.Close()
+	stmt, err := db.Prepare("select id from {{pf:reporting}}.reports")
+	c.Assert(err, IsNil)
+	stmt.Close()
+
+	c.Check(mock.queries, DeepEquals, []string{
+		"exec delete from `z_test_blog`.users where id = ?",
+		"query select id from `z_test_blog`.users",
+		"prepare select id from `z_test_reporting`.reports",
+	})
+}
+
+func (s *MySuite) Test_NewConnector(c *C) {
+	mock := &mockDriver{prepareOnly: true}
+	connector, err := (&Driver{Driver: mock, Rewriter: &Prefixr{}}).OpenConnector("")
+	c.Assert(err, IsNil)
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	// an empty prefix - production
+	_, err = db.Exec("delete from {{pf:blog}}.users where id = ?", 1)
+	c.Check(err, IsNil)
+	c.Check(mock.queries, DeepEquals, []string{"prepare delete from `blog`.users where id = ?"})
+
+	db = sql.OpenDB(NewConnector(connector, failingRewriter{}))
+	defer db.Close()
+	_, err = db.Exec("delete from {{pf:blog}}.users")
+	c.Check(err, ErrorMatches, "can't rewrite")
+	_, err = db.Query("select id from {{pf:blog}}.users")
+	c.Check(err, ErrorMatches, "can't rewrite")
+}
@@ -0,0 +1,224 @@
+package prefixr
+
+import (
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	// everything that isn't one of the others - operators, whitespace, punctuation
+	tokenText tokenKind = iota
+	// keywords and unquoted names
+	tokenWord
+	// 'single' or "double" quoted strings
+	tokenString
+	// `backtick` quoted identifiers
+	tokenIdentifier
+	// -- comments, # comments, and /* comments */
+	tokenComment
+	// {{pf:name}}, {{pf:`name`}}, and `{{pf:name}}` - and the table forms {{pf:name.table}} and
+	// {{pf:`name`.`table`}}
+	tokenPlaceholder
+	// {{schema}} and `{{schema}}` - the current schema, in ddl files
+	tokenCurrent
+	// the start of something that looks like a placeholder but isn't one - like {{pf:blog without the
+	// closing braces
+	tokenMalformed
+)
+
+// a piece of a query
+type token struct {
+	kind tokenKind
+	text string
+
+	// where the token starts in the query
+	offset int
+
+	// the schema name in a placeholder
+	name string
+	// the table name in a table placeholder
+	table string
+}
+
+const (
+	placeholderStart   = "{{pf:"
+	currentPlaceholder = "{{schema}}"
+)
+
+// splits a query into tokens. placeholders are only recognized where an identifier could go - not in
+// strings or comments. the text of the tokens adds up to the query.
+func lex(query string) (tokens []token) {
+	text := strings.Builder{}
+	textStart := 0
+	flush := func() {
+		if text.Len() > 0 {
+			tokens = append(tokens, token{kind: tokenText, text: text.String(), offset: textStart})
+			text.Reset()
+		}
+	}
+	add := func(kind tokenKind, start int, end int, name string, table string) int {
+		flush()
+		tokens = append(tokens, token{kind: kind, text: query[start:end], offset: start, name: name, table: table})
+		textStart = end
+		return end
+	}
+
+	// inside a /*! ... */ comment, which mysql runs like any other sql
+	executable := false
+
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case strings.HasPrefix(query[i:], placeholderStart):
+			name, table, end, ok := lexPlaceholder(query, i)
+			if ok {
+				i = add(tokenPlaceholder, i, end, name, table)
+			} else {
+				i = add(tokenMalformed, i, i+len(placeholderStart), "", "")
+			}
+
+		case strings.HasPrefix(query[i:], currentPlaceholder):
+			i = add(tokenCurrent, i, i+len(currentPlaceholder), "", "")
+
+		case c == '\'' || c == '"':
+			i = add(tokenString, i, quotedEnd(query, i, true), "", "")
+
+		case c == '`':
+			end := quotedEnd(query, i, false)
+
+			// a placeholder that's already quoted - `{{pf:name}}` or `{{schema}}`
+			if end-i > 2 && query[end-1] == '`' {
+				inner := query[i+1 : end-1]
+				if inner == currentPlaceholder {
+					i = add(tokenCurrent, i, end, "", "")
+					continue
+				}
+				if strings.HasPrefix(inner, placeholderStart) {
+					name, table, innerEnd, ok := lexPlaceholder(inner, 0)
+					if ok && innerEnd == len(inner) && table == "" {
+						i = add(tokenPlaceholder, i, end, name, "")
+						continue
+					}
+				}
+			}
+			i = add(tokenIdentifier, i, end, "", "")
+
+		case c == '#' || (c == '-' && strings.HasPrefix(query[i:], "--") && (i+2 == len(query) || isSpace(query[i+2]))):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query)
+			} else {
+				end += i
+			}
+			i = add(tokenComment, i, end, "", "")
+
+		case strings.HasPrefix(query[i:], "/*!"):
+			executable = true
+			text.WriteString("/*!")
+			i += 3
+
+		case executable && strings.HasPrefix(query[i:], "*/"):
+			executable = false
+			text.WriteString("*/")
+			i += 2
+
+		case strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				end = len(query)
+			} else {
+				end += i + 4
+			}
+			i = add(tokenComment, i, end, "", "")
+
+		case isWordByte(c):
+			end := i + 1
+			for end < len(query) && isWordByte(query[end]) {
+				end++
+			}
+			i = add(tokenWord, i, end, "", "")
+
+		default:
+			text.WriteByte(c)
+			i++
+		}
+	}
+
+	flush()
+	return
+}
+
+// reads the placeholder starting at start. end is just past the closing braces. table is only set for
+// the table forms.
+func lexPlaceholder(query string, start int) (name string, table string, end int, ok bool) {
+	i := start + len(placeholderStart)
+	if i < len(query) && query[i] == '`' {
+		// {{pf:`name`}} or {{pf:`name`.`table`}}
+		j := quotedEnd(query, i, false)
+		if j-i < 3 || query[j-1] != '`' {
+			return
+		}
+		name = strings.Replace(query[i+1:j-1], "``", "`", -1)
+
+		if strings.HasPrefix(query[j:], ".`") {
+			k := quotedEnd(query, j+1, false)
+			if k-j < 4 || query[k-1] != '`' || !strings.HasPrefix(query[k:], "}}") {
+				return "", "", 0, false
+			}
+			return name, strings.Replace(query[j+2:k-1], "``", "`", -1), k + 2, true
+		}
+		if !strings.HasPrefix(query[j:], "}}") {
+			return "", "", 0, false
+		}
+		return name, "", j + 2, true
+	}
+
+	// {{pf:name}} or {{pf:name.table}}
+	j := strings.Index(query[i:], "}}")
+	if j <= 0 {
+		return
+	}
+	name = query[i : i+j]
+	if strings.ContainsAny(name, " \t\r\n'\"`{}") {
+		return "", "", 0, false
+	}
+	if dot := strings.IndexByte(name, '.'); dot >= 0 {
+		name, table = name[:dot], name[dot+1:]
+		if name == "" || table == "" || strings.Contains(table, ".") {
+			return "", "", 0, false
+		}
+	}
+	return name, table, i + j + 2, true
+}
+
+// finds the end of a quoted string or identifier starting at start - just past the closing quote, or
+// the end of the query if it's never closed. a doubled quote is part of the string, and so is anything
+// after a backslash if escapes is set.
+func quotedEnd(query string, start int, escapes bool) int {
+	quote := query[start]
+	for i := start + 1; i < len(query); i++ {
+		switch {
+		case escapes && query[i] == '\\':
+			i++
+		case query[i] == quote:
+			if i+1 < len(query) && query[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(query)
+}
+
+const whitespace = " \t\n\r\f\v"
+
+func isSpace(c byte) bool {
+	return strings.IndexByte(whitespace, c) >= 0
+}
+
+// characters that can be part of an unquoted identifier - including any non-ascii character
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '$' || c >= 0x80
+}
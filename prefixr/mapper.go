@@ -0,0 +1,36 @@
+package prefixr
+
+// Mapper maps logical schema names to physical ones - for when the physical names aren't just the logical
+// names with a prefix. Names that are in Names map to their value there. Any other name maps to Prefix +
+// name + Suffix - no underscores are added:
+//
+//	m := &prefixr.Mapper{
+//		Names:  map[string]string{"reporting": "analytics"},
+//		Suffix: "_staging",
+//	}
+//	m.Schema("blog")      // blog_staging
+//	m.Schema("reporting") // analytics
+type Mapper struct {
+	Names  map[string]string
+	Prefix string
+	Suffix string
+}
+
+// Schema gets the physical name of a schema.
+func (m *Mapper) Schema(name string) string {
+	if physical, ok := m.Names[name]; ok {
+		return physical
+	}
+	return m.Prefix + name + m.Suffix
+}
+
+// Map replaces the {{pf:name}} placeholders in a query with the physical schema names. It understands the
+// same placeholders as Prefix.
+func (m *Mapper) Map(query string) string {
+	return Compile(query).render(m.Schema, "", nil)
+}
+
+// Rewrite maps the schema names in a query - it makes Mapper a Rewriter.
+func (m *Mapper) Rewrite(query string) (string, error) {
+	return m.Map(query), nil
+}
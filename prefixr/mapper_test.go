@@ -0,0 +1,25 @@
+package prefixr
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) Test_Mapper(c *C) {
+	m := &Mapper{
+		Names:  map[string]string{"reporting": "analytics"},
+		Suffix: "_staging",
+	}
+	c.Check(m.Schema("blog"), Equals, "blog_staging")
+	c.Check(m.Schema("reporting"), Equals, "analytics")
+
+	query := "SELECT * FROM {{pf:blog}}.users JOIN `{{pf:reporting}}`.reports WHERE note != '{{pf:blog}}'"
+	c.Check(m.Map(query), Equals, "SELECT * FROM `blog_staging`.users JOIN `analytics`.reports WHERE note != '{{pf:blog}}'")
+
+	m = &Mapper{Prefix: "z_test_"}
+	rewritten, err := m.Rewrite("SELECT * FROM {{pf:blog}}.users")
+	c.Check(err, IsNil)
+	c.Check(rewritten, Equals, "SELECT * FROM `z_test_blog`.users")
+
+	// no names, prefix, or suffix - the logical names
+	c.Check((&Mapper{}).Map("{{pf:blog}}"), Equals, "`blog`")
+}
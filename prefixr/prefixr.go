@@ -3,20 +3,69 @@ package prefixr
 
 import (
 	"fmt"
-	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 // Prefixr keeps track of a single prefix and can apply to to multiple queries.
-// If you plan to apply the same prefix to multiple queries, then use one of these.
+// If you plan to apply the same prefix to multiple queries, then use one of these. A Prefixr can be
+// copied - copies share the caches, which is fine even if the copy gets a different prefix or schemas.
 type Prefixr struct {
 	PrefixString string
+
+	// Schemas are the logical schema names - the ones in the fixrupr config.
+	Schemas []string
+
+	// Qualified also rewrites schema-qualified names that don't use placeholders, for the schemas in
+	// Schemas: blog.users and `blog`.`users` become `my-prefix_blog`.users and `my-prefix_blog`.`users`.
+	// A table alias with the same name as one of the schemas gets rewritten too.
+	Qualified bool
+
+	// Strict makes PrefixE return an error for placeholders with names that aren't in Schemas, and for
+	// malformed placeholders - like {{pf:blog without the closing braces - instead of leaving typos for
+	// the database to complain about.
+	Strict bool
+
+	// Current is the schema {{schema}} stands for, the way it does in fixrupr's ddl files. If it's empty,
+	// {{schema}} is left alone.
+	Current string
+
+	// the *prefixrCache - behind a pointer, so a Prefixr can be copied
+	caches atomic.Value
+}
+
+// what a Prefixr caches
+type prefixrCache struct {
+	// compiled templates, by query
+	templates sync.Map
+	cached    int64
+
+	// the *knownSchemas for Schemas
+	known atomic.Value
+
+	// the *unprefixPattern Unprefix uses
+	pattern atomic.Value
+}
+
+// Schemas as a set, and the Schemas it was made from
+type knownSchemas struct {
+	schemas []string
+	known   map[string]bool
 }
 
+// the most queries a Prefixr caches templates for
+const maxCached = 10000
+
+// the caches the package-level Prefix and Unprefix use - templates don't depend on the prefix, so they
+// can be shared
+var sharedCache = &prefixrCache{}
+
 // Prefix takes a query string and applies the prefix to the beginning of schema names
 // The schema names must match a specific pattern. For example, if your original query is
 //   SELECT *
 //   FROM blog
-//   JOIN reporing
+//   JOIN reporting
 //
 // Then you will want to write that query as
 //   SELECT *
@@ -26,16 +75,121 @@ type Prefixr struct {
 // If you PrefixString is "my-prefix" then, the prefixed query will be:
 //   SELECT *
 //   FROM `my-prefix_blog`
-//   JOIN `my-prefix_reporing`
+//   JOIN `my-prefix_reporting`
 func (p *Prefixr) Prefix(query string) string {
-	return Prefix(p.PrefixString, query)
+	return p.template(query).render(p.schema, p.Current, p.qualified())
+}
+
+// PrefixE is Prefix, but in Strict mode it returns an error for unknown schema names and malformed
+// placeholders.
+func (p *Prefixr) PrefixE(query string) (string, error) {
+	t := p.template(query)
+	if p.Strict {
+		err := t.check(p.known(), p.Current)
+		if err != nil {
+			return "", err
+		}
+	}
+	return t.render(p.schema, p.Current, p.qualified()), nil
+}
+
+// Template gets the compiled template for a query. Templates are cached, so a query is only compiled
+// once per Prefixr - the cache is safe to use from several goroutines. Once the cache has 10000
+// queries, more aren't added.
+func (p *Prefixr) Template(query string) *Template {
+	return p.template(query)
+}
+
+func (p *Prefixr) template(query string) *Template {
+	return p.cache().template(query)
+}
+
+// gets the caches, making them the first time
+func (p *Prefixr) cache() *prefixrCache {
+	if c, ok := p.caches.Load().(*prefixrCache); ok {
+		return c
+	}
+	p.caches.CompareAndSwap(nil, &prefixrCache{})
+	return p.caches.Load().(*prefixrCache)
+}
+
+func (c *prefixrCache) template(query string) *Template {
+	if cached, ok := c.templates.Load(query); ok {
+		return cached.(*Template)
+	}
+
+	t := Compile(query)
+	if atomic.LoadInt64(&c.cached) < maxCached {
+		if _, loaded := c.templates.LoadOrStore(query, t); !loaded {
+			atomic.AddInt64(&c.cached, 1)
+		}
+	}
+	return t
+}
+
+// the schemas in Schemas, as a set - built again only when Schemas changes. don't modify it.
+func (p *Prefixr) known() map[string]bool {
+	c := p.cache()
+	if cached, ok := c.known.Load().(*knownSchemas); ok && equalStrings(cached.schemas, p.Schemas) {
+		return cached.known
+	}
+
+	known := map[string]bool{}
+	for _, schema := range p.Schemas {
+		known[schema] = true
+	}
+	c.known.Store(&knownSchemas{schemas: append([]string{}, p.Schemas...), known: known})
+	return known
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// a Prefixr for the package-level functions, with the shared caches
+func sharedPrefixr(prefix string) *Prefixr {
+	p := &Prefixr{PrefixString: prefix}
+	p.caches.Store(sharedCache)
+	return p
+}
+
+// the schemas whose qualified names are rewritten - none unless Qualified is set
+func (p *Prefixr) qualified() map[string]bool {
+	if !p.Qualified {
+		return nil
+	}
+	return p.known()
+}
+
+// the start of the rest of a query, for error messages
+func excerpt(query string) string {
+	if len(query) > 20 {
+		return query[0:20] + "..."
+	}
+	return query
+}
+
+// gets the physical name of a schema. if the prefix is empty, then don't include an underscore
+func (p *Prefixr) schema(name string) string {
+	if p.PrefixString == "" {
+		return name
+	}
+	return fmt.Sprintf("%s_%s", p.PrefixString, name)
 }
 
 // Prefix takes a query string and applies the prefix to the beginning of schema names
 // The schema names must match a specific pattern. For example, if your original query is
 //   SELECT *
 //   FROM blog
-//   JOIN reporing
+//   JOIN reporting
 //
 // Then you will want to write that query as
 //   SELECT *
@@ -45,27 +199,23 @@ func (p *Prefixr) Prefix(query string) string {
 // If you prefix is "my-prefix" then, the prefixed query will be:
 //   SELECT *
 //   FROM `my-prefix_blog`
-//   JOIN `my-prefix_reporing`
+//   JOIN `my-prefix_reporting`
+//
+// Placeholders inside string literals and comments are left alone. Queries are parsed once and cached,
+// the same as with a Prefixr.
 func Prefix(prefix, query string) string {
-	// if the prefix is empty, then don't include an underscore
-	format := "`%s_%s`"
-	if prefix == "" {
-		format = "`%s%s`"
-	}
-
-	r := regexp.MustCompile("{{pf:`.+?`}}")
-	prefixed := r.ReplaceAllStringFunc(query, func(match string) string {
-		return fmt.Sprintf(format, prefix, match[6:len(match)-3])
-	})
-
-	r = regexp.MustCompile("`{{pf:.+?}}`")
+	p := sharedPrefixr(prefix)
+	return p.template(query).render(p.schema, "", nil)
+}
 
-	prefixed = r.ReplaceAllStringFunc(prefixed, func(match string) string {
-		return fmt.Sprintf(format, prefix, match[6:len(match)-3])
-	})
+// gets the name in a word or quoted identifier token
+func identifierName(t token) string {
+	if t.kind == tokenIdentifier && len(t.text) >= 2 && strings.HasSuffix(t.text, "`") {
+		return strings.Replace(t.text[1:len(t.text)-1], "``", "`", -1)
+	}
+	return t.text
+}
 
-	r = regexp.MustCompile("{{pf:.+?}}")
-	return r.ReplaceAllStringFunc(prefixed, func(match string) string {
-		return fmt.Sprintf(format, prefix, match[5:len(match)-2])
-	})
+func quoteIdentifier(name string) string {
+	return fmt.Sprintf("`%s`", strings.Replace(name, "`", "``", -1))
 }
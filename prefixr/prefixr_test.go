@@ -40,3 +40,104 @@ func (s *MySuite) Test_Prefix(c *C) {
 	prefixed = Prefix("", query)
 	c.Check(prefixed, Equals, "SELECT * FROM `blog`.users JOIN `reporing`.reports JOIN `schemas` JOIN other")
 }
+
+func (s *MySuite) Test_Prefix_literals(c *C) {
+	query := "SELECT '{{pf:blog}}', \"it''s {{pf:blog}}\", 'don\\'t {{pf:blog}}' FROM {{pf:blog}}.users -- {{pf:blog}}\n" +
+		"# {{pf:blog}}\nWHERE /* {{pf:blog}} */ id IN (SELECT id FROM `{{pf:blog}}`.`{{pf:blog}} archive`)"
+	c.Check(Prefix("p", query), Equals, "SELECT '{{pf:blog}}', \"it''s {{pf:blog}}\", 'don\\'t {{pf:blog}}' FROM `p_blog`.users -- {{pf:blog}}\n"+
+		"# {{pf:blog}}\nWHERE /* {{pf:blog}} */ id IN (SELECT id FROM `p_blog`.`{{pf:blog}} archive`)")
+
+	// mysql runs the sql in /*! */ comments
+	c.Check(Prefix("p", "SELECT 1 /*!50700 FROM {{pf:blog}}.users */"), Equals, "SELECT 1 /*!50700 FROM `p_blog`.users */")
+
+	// short quoted names
+	c.Check(Prefix("p", "SELECT `id` FROM `t`"), Equals, "SELECT `id` FROM `t`")
+
+	// quoted names next to each other
+	c.Check(Prefix("p", "{{pf:`a`}}.{{pf:b}}"), Equals, "`p_a`.`p_b`")
+	c.Check(Prefix("p", "{{pf:`we``ird`}}"), Equals, "`p_we``ird`")
+
+	// not placeholders
+	c.Check(Prefix("p", "SELECT {{pf:}} {{pf:a b}} {{pf:blog"), Equals, "SELECT {{pf:}} {{pf:a b}} {{pf:blog")
+	c.Check(Prefix("p", "SELECT 1 --{{pf:blog}}"), Equals, "SELECT 1 --`p_blog`")
+}
+
+func (s *MySuite) Test_Prefix_tables(c *C) {
+	c.Check(Prefix("z_x", "SELECT * FROM {{pf:blog.users}} u JOIN {{pf:`blog`.`weird``name`}} w"), Equals,
+		"SELECT * FROM `z_x_blog`.`users` u JOIN `z_x_blog`.`weird``name` w")
+	c.Check(Prefix("", "SELECT * FROM {{pf:blog.users}}"), Equals, "SELECT * FROM `blog`.`users`")
+
+	// not placeholders - a table placeholder can't be quoted again, and has exactly one dot
+	c.Check(Prefix("z_x", "{{pf:blog.}} {{pf:.users}} {{pf:a.b.c}} {{pf:`blog`.users}}"), Equals, "{{pf:blog.}} {{pf:.users}} {{pf:a.b.c}} {{pf:`blog`.users}}")
+	c.Check(Prefix("z_x", "`{{pf:blog.users}}`"), Equals, "`{{pf:blog.users}}`")
+
+	p := &Prefixr{PrefixString: "z_x", Schemas: []string{"blog"}, Strict: true}
+	_, err := p.PrefixE("SELECT * FROM {{pf:reporting.reports}}")
+	c.Check(err, ErrorMatches, `unknown schema "reporting" in placeholder {{pf:reporting.reports}} at offset 14`)
+	_, err = p.PrefixE("SELECT * FROM {{pf:blog.}}")
+	c.Check(err, ErrorMatches, `malformed placeholder at offset 14: {{pf:blog.}}`)
+}
+
+func (s *MySuite) Test_Prefixr_Prefix_current(c *C) {
+	p := &Prefixr{PrefixString: "z_x", Current: "blog"}
+	c.Check(p.Prefix("create view {{schema}}.active as select * from `{{schema}}`.users join {{pf:reporting.reports}} using (id)"), Equals,
+		"create view `z_x_blog`.active as select * from `z_x_blog`.users join `z_x_reporting`.`reports` using (id)")
+
+	// without a current schema, it's left alone - or an error in strict mode
+	p = &Prefixr{PrefixString: "z_x", Schemas: []string{"blog"}}
+	c.Check(p.Prefix("select * from {{schema}}.users"), Equals, "select * from {{schema}}.users")
+	p.Strict = true
+	_, err := p.PrefixE("select * from {{schema}}.users")
+	c.Check(err, ErrorMatches, `placeholder {{schema}} at offset 14 needs a current schema`)
+
+	// the current schema doesn't have to be in Schemas
+	p.Current = "reporting"
+	prefixed, err := p.PrefixE("select * from {{schema}}.reports")
+	c.Check(err, IsNil)
+	c.Check(prefixed, Equals, "select * from `z_x_reporting`.reports")
+}
+
+func (s *MySuite) Test_Prefixr_Prefix_qualified(c *C) {
+	p := &Prefixr{PrefixString: "p", Schemas: []string{"blog", "reporting"}, Qualified: true}
+
+	query := "SELECT u.id, blog.users.name FROM blog.users u JOIN `reporting` . `reports` r " +
+		"JOIN other.blog b JOIN {{pf:blog}}.articles WHERE note = 'blog.users' -- blog.users\n" +
+		"AND u.id IN (SELECT id FROM blogs.users) AND blog = 1"
+	c.Check(p.Prefix(query), Equals, "SELECT u.id, `p_blog`.users.name FROM `p_blog`.users u JOIN `p_reporting` . `reports` r "+
+		"JOIN other.blog b JOIN `p_blog`.articles WHERE note = 'blog.users' -- blog.users\n"+
+		"AND u.id IN (SELECT id FROM blogs.users) AND blog = 1")
+
+	// only when asked for
+	p.Qualified = false
+	c.Check(p.Prefix("SELECT * FROM blog.users"), Equals, "SELECT * FROM blog.users")
+}
+
+func (s *MySuite) Test_Prefixr_PrefixE(c *C) {
+	p := &Prefixr{PrefixString: "p", Schemas: []string{"blog", "reporting"}, Strict: true}
+
+	prefixed, err := p.PrefixE("SELECT * FROM {{pf:blog}}.users JOIN `{{pf:reporting}}`.reports WHERE note = '{{pf:nope'")
+	c.Check(err, IsNil)
+	c.Check(prefixed, Equals, "SELECT * FROM `p_blog`.users JOIN `p_reporting`.reports WHERE note = '{{pf:nope'")
+
+	_, err = p.PrefixE("SELECT * FROM {{pf:blog}}.users JOIN {{pf:reporing}}.reports")
+	c.Check(err, ErrorMatches, `unknown schema "reporing" in placeholder {{pf:reporing}} at offset 37`)
+
+	_, err = p.PrefixE("SELECT * FROM {{pf:blog.users")
+	c.Check(err, ErrorMatches, `malformed placeholder at offset 14: {{pf:blog.users`)
+
+	_, err = p.PrefixE("SELECT * FROM {{pf:blog users}} JOIN reporting.reports")
+	c.Check(err, ErrorMatches, `malformed placeholder at offset 14: {{pf:blog users}} JO\.\.\.`)
+
+	_, err = p.PrefixE("SELECT * FROM `{{pf:blog}`.users")
+	c.Check(err, ErrorMatches, "malformed placeholder at offset 14: `{{pf:blog}`")
+
+	// the driver gets the errors too
+	_, err = p.Rewrite("SELECT * FROM {{pf:reporing}}.reports")
+	c.Check(err, ErrorMatches, `unknown schema "reporing" .*`)
+
+	// not strict - typos are left for the database
+	p.Strict = false
+	prefixed, err = p.PrefixE("SELECT * FROM {{pf:reporing}}.reports JOIN {{pf:blog")
+	c.Check(err, IsNil)
+	c.Check(prefixed, Equals, "SELECT * FROM `p_reporing`.reports JOIN {{pf:blog")
+}
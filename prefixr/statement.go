@@ -0,0 +1,161 @@
+package prefixr
+
+import (
+	"strings"
+)
+
+// the kinds of object a create statement can create
+var createdKinds = map[string]bool{
+	"table": true, "view": true, "function": true, "procedure": true, "trigger": true, "event": true, "index": true,
+	"schema": true, "database": true, "user": true, "role": true, "server": true, "tablespace": true, "sequence": true,
+}
+
+// keywords that can follow a table name - they're never an alias for it
+var notAliases = map[string]bool{
+	"as": true, "select": true, "from": true, "join": true, "inner": true, "cross": true, "left": true, "right": true,
+	"outer": true, "natural": true, "straight_join": true, "lateral": true, "on": true, "using": true, "where": true,
+	"group": true, "order": true, "having": true, "limit": true, "union": true, "except": true, "intersect": true,
+	"window": true, "for": true, "lock": true, "into": true, "set": true, "values": true, "use": true, "ignore": true,
+	"force": true, "partition": true, "with": true, "and": true, "or": true, "not": true, "when": true, "then": true,
+	"else": true, "end": true, "returning": true,
+}
+
+// keywords that end a from clause - commas after them aren't between tables
+var fromEnds = map[string]bool{
+	"where": true, "group": true, "order": true, "having": true, "limit": true, "union": true, "except": true,
+	"intersect": true, "window": true, "for": true, "lock": true, "into": true, "set": true, "values": true,
+}
+
+// the kind of object a create statement creates, in lower case - the first one of createdKinds after
+// the create. empty if the query doesn't start with create. comments are skipped, and so are the version
+// numbers of /*!50001 ... */ comments.
+func creates(tokens []token) string {
+	started := false
+	for _, tok := range tokens {
+		if tok.kind != tokenWord || strings.Trim(tok.text, "0123456789") == "" {
+			continue
+		}
+		word := strings.ToLower(tok.text)
+		if !started {
+			if word != "create" {
+				return ""
+			}
+			started = true
+			continue
+		}
+		if createdKinds[word] {
+			return word
+		}
+	}
+	return ""
+}
+
+// a token that matters for finding aliases - a name, or a single character of punctuation
+type piece struct {
+	// the name, for words and identifiers
+	name string
+	// the lower case keyword, for words
+	word string
+	// the character, for punctuation. strings are a ' - they're never part of a table name
+	punct byte
+	// a schema placeholder - it can start a table name, but it isn't an alias
+	placeholder bool
+}
+
+// the names that are given to a table in a from clause - "from blog.users u", "join `reporting`.`reports`
+// as r" and "from (select ...) recent" alias u, r and recent - and the names after any other as. keywords
+// that can follow a table name aren't aliases.
+func aliases(tokens []token) (names []string) {
+	pieces := []piece{}
+	for _, tok := range tokens {
+		switch tok.kind {
+		case tokenWord:
+			pieces = append(pieces, piece{name: tok.text, word: strings.ToLower(tok.text)})
+		case tokenIdentifier:
+			pieces = append(pieces, piece{name: identifierName(tok)})
+		case tokenText:
+			for i := 0; i < len(tok.text); i++ {
+				if !isSpace(tok.text[i]) {
+					pieces = append(pieces, piece{punct: tok.text[i]})
+				}
+			}
+		case tokenPlaceholder, tokenCurrent:
+			pieces = append(pieces, piece{placeholder: true})
+		case tokenString, tokenMalformed:
+			pieces = append(pieces, piece{punct: '\''})
+		}
+	}
+
+	const (
+		// nothing that leads to an alias
+		none = iota
+		// where a table goes - after from, join, or a comma between tables
+		table
+		// just after a table name, or a subquery in a from clause
+		named
+		// the dot in a qualified table name
+		dot
+		// after as
+		as
+	)
+
+	// a paren - from is whether it's in a from clause, and derived whether it started where a table goes,
+	// so the name after it is an alias
+	type paren struct{ from, derived bool }
+	parens := []paren{{}}
+
+	state := none
+	for _, p := range pieces {
+		current := &parens[len(parens)-1]
+		switch {
+		case p.punct == '(':
+			parens = append(parens, paren{from: state == table, derived: state == table})
+			if state != table {
+				state = none
+			}
+		case p.punct == ')':
+			state = none
+			if len(parens) > 1 {
+				if current.derived {
+					state = named
+				}
+				parens = parens[:len(parens)-1]
+			}
+		case p.punct == ',':
+			state = none
+			if current.from {
+				state = table
+			}
+		case p.punct == '.':
+			if state == named {
+				state = dot
+			} else {
+				state = none
+			}
+		case p.punct != 0:
+			state = none
+		case p.word == "select":
+			current.from = false
+			state = none
+		case p.word == "from" || p.word == "join" || p.word == "straight_join":
+			current.from = true
+			state = table
+		case p.word == "lateral" && state == table:
+		case p.word == "as":
+			state = as
+		case notAliases[p.word]:
+			if fromEnds[p.word] {
+				current.from = false
+			}
+			state = none
+		case state == table || state == dot:
+			state = named
+		case (state == named || state == as) && !p.placeholder:
+			names = append(names, p.name)
+			state = none
+		default:
+			state = none
+		}
+	}
+	return
+}
@@ -0,0 +1,42 @@
+package prefixr
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) Test_Template_Creates(c *C) {
+	expected := map[string]string{
+		"create table {{schema}}.users (id int)":                                           "table",
+		"-- active users\ncreate view {{schema}}.active as select 1":                       "view",
+		"/* v */ CREATE VIEW {{schema}}.active AS select 1":                                "view",
+		"create table {{schema}}.`view` (id int)":                                          "table",
+		"CREATE OR REPLACE ALGORITHM=MERGE DEFINER=`root`@`%` SQL SECURITY DEFINER VIEW v": "view",
+		"/*!50001 CREATE ALGORITHM=UNDEFINED */ /*!50001 VIEW `v` AS select 1 */":          "view",
+		"create temporary table t (id int)":                                                "table",
+		"create function {{schema}}.greet() returns int return 1":                          "function",
+		"select 'create view'":                                                             "",
+		"# create view\ninsert into t values (1)":                                          "",
+	}
+	for query, kind := range expected {
+		c.Check(Compile(query).Creates(), Equals, kind, Commentf(query))
+	}
+}
+
+func (s *MySuite) Test_Template_Aliases(c *C) {
+	expected := map[string][]string{
+		"select * from a.t join b.u blog":                                                                    {"blog"},
+		"select * from blog.users u, `reporting`.`reports` as r":                                             {"u", "r"},
+		"select u.id as user_id from {{pf:blog}}.users u where u.id > 1":                                     {"user_id", "u"},
+		"select * from (select id from blog.users) recent left join blog.posts on recent.id = posts.user_id": {"recent"},
+
+		// how mysql writes view definitions out
+		"select `a`.`id` AS `id` from (`db`.`t` `a` join `db`.`u` `b` on((`a`.`id` = `b`.`id`))) where (`b`.`x` = 'from c d')": {"id", "a", "b"},
+
+		// keywords aren't aliases, and nor are names outside of a from clause
+		"select count(*) from blog.users where id in (1, 2) group by name order by name limit 1": nil,
+		"select blog.id from blog.users natural join blog.posts":                                 nil,
+	}
+	for query, names := range expected {
+		c.Check(Compile(query).Aliases(), DeepEquals, names, Commentf(query))
+	}
+}
@@ -0,0 +1,219 @@
+package prefixr
+
+import (
+	"fmt"
+	"strings"
+)
+
+type segmentKind int
+
+const (
+	// text that's never rewritten
+	segmentLiteral segmentKind = iota
+	// a {{pf:name}} or {{pf:name.table}} placeholder
+	segmentPlaceholder
+	// a {{schema}} placeholder
+	segmentCurrent
+	// a name followed by a dot - rewritten if it's a known schema and qualified names are being rewritten
+	segmentQualifier
+)
+
+type segment struct {
+	kind segmentKind
+	text string
+
+	// the schema name in a placeholder or qualifier
+	name string
+	// the table name in a table placeholder
+	table string
+	// where the segment starts in the query
+	offset int
+}
+
+// Template is a query that has been parsed into literal text and placeholders, so it can be rendered
+// with any prefix without parsing the query again. Templates are safe to use from several goroutines.
+type Template struct {
+	query    string
+	segments []segment
+
+	// the first malformed placeholder - reported in strict mode
+	malformed       error
+	malformedOffset int
+
+	// what the query creates, if it's a create statement
+	creates string
+	// the table aliases and other names given with as
+	aliases []string
+}
+
+// Compile parses a query into a Template.
+func Compile(query string) *Template {
+	t := &Template{query: query}
+	literal := strings.Builder{}
+	literalStart := 0
+	flush := func() {
+		if literal.Len() > 0 {
+			t.segments = append(t.segments, segment{kind: segmentLiteral, text: literal.String(), offset: literalStart})
+			literal.Reset()
+		}
+	}
+
+	tokens := lex(query)
+	t.creates = creates(tokens)
+	t.aliases = aliases(tokens)
+	for i, tok := range tokens {
+		if t.malformed == nil {
+			switch {
+			case tok.kind == tokenMalformed:
+				t.malformed = fmt.Errorf("malformed placeholder at offset %d: %s", tok.offset, excerpt(query[tok.offset:]))
+			case tok.kind == tokenIdentifier && strings.Contains(tok.text, placeholderStart):
+				t.malformed = fmt.Errorf("malformed placeholder at offset %d: %s", tok.offset, excerpt(tok.text))
+			}
+			if t.malformed != nil {
+				t.malformedOffset = tok.offset
+			}
+		}
+
+		switch {
+		case tok.kind == tokenPlaceholder:
+			flush()
+			t.segments = append(t.segments, segment{kind: segmentPlaceholder, text: tok.text, name: tok.name, table: tok.table, offset: tok.offset})
+		case tok.kind == tokenCurrent:
+			flush()
+			t.segments = append(t.segments, segment{kind: segmentCurrent, text: tok.text, offset: tok.offset})
+		case isQualifier(tokens, i):
+			flush()
+			t.segments = append(t.segments, segment{kind: segmentQualifier, text: tok.text, name: identifierName(tok), offset: tok.offset})
+		default:
+			if literal.Len() == 0 {
+				literalStart = tok.offset
+			}
+			literal.WriteString(tok.text)
+			continue
+		}
+		literalStart = tok.offset + len(tok.text)
+	}
+	flush()
+
+	return t
+}
+
+// Render replaces the placeholders with the prefixed schema names - the same as Prefix. {{schema}} is
+// left alone.
+func (t *Template) Render(prefix string) string {
+	p := &Prefixr{PrefixString: prefix}
+	return t.render(p.schema, "", nil)
+}
+
+// RenderFunc replaces the placeholders with the schema names schema returns. {{schema}} is left alone.
+func (t *Template) RenderFunc(schema func(name string) string) string {
+	return t.render(schema, "", nil)
+}
+
+// Schemas gets the schema names in the placeholders, in the order they appear.
+func (t *Template) Schemas() (names []string) {
+	for _, s := range t.segments {
+		if s.kind == segmentPlaceholder {
+			names = append(names, s.name)
+		}
+	}
+	return
+}
+
+// Qualifiers gets the names that qualify another name - the "blog" in blog.users or `blog`.`users` - in
+// the order they appear. Names in strings and comments, and placeholders, aren't included.
+func (t *Template) Qualifiers() (names []string) {
+	for _, s := range t.segments {
+		if s.kind == segmentQualifier {
+			names = append(names, s.name)
+		}
+	}
+	return
+}
+
+// Creates gets the kind of object the query creates, in lower case - "table", "view", "function" and so
+// on. It's empty if the query isn't a create statement. Leading comments are skipped, so it's "view" for
+// "-- active users\ncreate view ..." and "table" for "create table {{schema}}.`view` (id int)".
+func (t *Template) Creates() string {
+	return t.creates
+}
+
+// Aliases gets the names given to tables in from clauses - the "u" in "from blog.users u" or "join
+// `blog`.`users` as u" - and to anything else with as, in the order they appear. Keywords that can follow
+// a table name, like join and where, aren't aliases.
+func (t *Template) Aliases() []string {
+	return t.aliases
+}
+
+// replaces the placeholders with the quoted physical schema names
+// schema: gets the physical name of a schema
+// current (optional): the schema {{schema}} stands for
+// qualified (optional): schemas whose qualified names are rewritten even without placeholders
+func (t *Template) render(schema func(name string) string, current string, qualified map[string]bool) string {
+	rendered := strings.Builder{}
+	rendered.Grow(len(t.query) + 16*len(t.segments))
+	for _, s := range t.segments {
+		switch {
+		case s.kind == segmentPlaceholder:
+			rendered.WriteString(quoteIdentifier(schema(s.name)))
+			if s.table != "" {
+				rendered.WriteString(".")
+				rendered.WriteString(quoteIdentifier(s.table))
+			}
+		case s.kind == segmentCurrent && current != "":
+			rendered.WriteString(quoteIdentifier(schema(current)))
+		case s.kind == segmentQualifier && qualified[s.name]:
+			rendered.WriteString(quoteIdentifier(schema(s.name)))
+		default:
+			rendered.WriteString(s.text)
+		}
+	}
+	return rendered.String()
+}
+
+// finds placeholders that are malformed or name schemas that aren't known
+// current: the schema {{schema}} stands for - {{schema}} is an error without one
+func (t *Template) check(known map[string]bool, current string) error {
+	for _, s := range t.segments {
+		// whichever comes first in the query
+		if t.malformed != nil && s.offset > t.malformedOffset {
+			break
+		}
+		if s.kind == segmentPlaceholder && !known[s.name] {
+			return fmt.Errorf("unknown schema %q in placeholder %s at offset %d", s.name, s.text, s.offset)
+		}
+		if s.kind == segmentCurrent && current == "" {
+			return fmt.Errorf("placeholder %s at offset %d needs a current schema", s.text, s.offset)
+		}
+	}
+	return t.malformed
+}
+
+// checks whether a token is a name qualifying another name - followed by a dot, and not itself
+// qualified by something else
+func isQualifier(tokens []token, i int) bool {
+	t := tokens[i]
+	if t.kind != tokenWord && t.kind != tokenIdentifier {
+		return false
+	}
+
+	next := ""
+	for j := i + 1; j < len(tokens) && next == ""; j++ {
+		if tokens[j].kind != tokenText {
+			break
+		}
+		next = strings.TrimLeft(tokens[j].text, whitespace)
+	}
+	if !strings.HasPrefix(next, ".") {
+		return false
+	}
+
+	previous := ""
+	for j := i - 1; j >= 0 && previous == ""; j-- {
+		if tokens[j].kind != tokenText {
+			break
+		}
+		previous = strings.TrimRight(tokens[j].text, whitespace)
+	}
+	return !strings.HasSuffix(previous, ".")
+}
@@ -0,0 +1,167 @@
+package prefixr
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) Test_Template(c *C) {
+	t := Compile("SELECT * FROM {{pf:blog}}.users JOIN `{{pf:reporting}}`.reports r ON blog.x = r.y WHERE note != '{{pf:blog}}'")
+	c.Check(t.Schemas(), DeepEquals, []string{"blog", "reporting"})
+
+	c.Check(t.Render("z_test"), Equals, "SELECT * FROM `z_test_blog`.users JOIN `z_test_reporting`.reports r ON blog.x = r.y WHERE note != '{{pf:blog}}'")
+	c.Check(t.Render(""), Equals, "SELECT * FROM `blog`.users JOIN `reporting`.reports r ON blog.x = r.y WHERE note != '{{pf:blog}}'")
+	c.Check(t.RenderFunc(strings.ToUpper), Equals, "SELECT * FROM `BLOG`.users JOIN `REPORTING`.reports r ON blog.x = r.y WHERE note != '{{pf:blog}}'")
+
+	// the same template, with qualified names rewritten
+	c.Check(t.render((&Prefixr{PrefixString: "z_test"}).schema, "", map[string]bool{"blog": true}), Equals,
+		"SELECT * FROM `z_test_blog`.users JOIN `z_test_reporting`.reports r ON `z_test_blog`.x = r.y WHERE note != '{{pf:blog}}'")
+
+	// no placeholders
+	c.Check(Compile("SELECT 1").Render("z_test"), Equals, "SELECT 1")
+	c.Check(Compile("").Render("z_test"), Equals, "")
+	c.Check(Compile("SELECT 1").Schemas(), IsNil)
+
+	// names qualifying other names, outside of strings and comments
+	c.Check(t.Qualifiers(), DeepEquals, []string{"blog", "r"})
+	c.Check(Compile("SELECT u.id FROM `z_blog` . users u -- reporting.reports").Qualifiers(), DeepEquals, []string{"u", "z_blog"})
+}
+
+func (s *MySuite) Test_Template_check(c *C) {
+	known := map[string]bool{"blog": true}
+	c.Check(Compile("SELECT * FROM {{pf:blog}}.users").check(known, ""), IsNil)
+
+	// whichever problem comes first
+	c.Check(Compile("SELECT * FROM {{pf:nope}}.users JOIN {{pf:blog").check(known, ""), ErrorMatches, `unknown schema "nope" .* at offset 14`)
+	c.Check(Compile("SELECT * FROM {{pf:blog JOIN {{pf:nope}}.users").check(known, ""), ErrorMatches, "malformed placeholder at offset 14: .*")
+}
+
+func (s *MySuite) Test_Prefixr_Template(c *C) {
+	p := &Prefixr{PrefixString: "z_test"}
+	query := "SELECT * FROM {{pf:blog}}.users"
+	c.Check(p.Template(query), Equals, p.Template(query))
+	c.Check(p.cache().cached, Equals, int64(1))
+
+	// once the cache is full, templates are still compiled, just not kept
+	p.cache().cached = maxCached
+	other := "SELECT * FROM {{pf:reporting}}.reports"
+	c.Check(p.Template(other), Not(Equals), p.Template(other))
+	c.Check(p.Prefix(other), Equals, "SELECT * FROM `z_test_reporting`.reports")
+}
+
+func (s *MySuite) Test_Prefixr_concurrent(c *C) {
+	p := &Prefixr{PrefixString: "z_test", Schemas: []string{"blog"}, Qualified: true, Strict: true}
+	wg := sync.WaitGroup{}
+	results := make([]string, 20)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = p.PrefixE(fmt.Sprintf("SELECT %d FROM {{pf:blog}}.users JOIN blog.comments", i%4))
+		}(i)
+	}
+	wg.Wait()
+
+	for i, result := range results {
+		c.Check(result, Equals, fmt.Sprintf("SELECT %d FROM `z_test_blog`.users JOIN `z_test_blog`.comments", i%4))
+	}
+	c.Check(p.cache().cached, Equals, int64(4))
+}
+
+func (s *MySuite) Test_Prefixr_copy(c *C) {
+	p := Prefixr{PrefixString: "z_test", Schemas: []string{"blog"}, Qualified: true}
+	query := "SELECT * FROM blog.users JOIN reporting.reports"
+	c.Check(p.Prefix(query), Equals, "SELECT * FROM `z_test_blog`.users JOIN reporting.reports")
+
+	// a copy shares the caches, but not the settings
+	copied := p
+	copied.PrefixString = "z_copy"
+	copied.Schemas = []string{"reporting"}
+	c.Check(copied.Template(query), Equals, p.Template(query))
+	c.Check(copied.Prefix(query), Equals, "SELECT * FROM blog.users JOIN `z_copy_reporting`.reports")
+	c.Check(copied.Unprefix("`z_copy_reporting`.reports `z_copy_blog`.users"), Equals, "`reporting`.reports `z_copy_blog`.users")
+	c.Check(p.Prefix(query), Equals, "SELECT * FROM `z_test_blog`.users JOIN reporting.reports")
+
+	// the set of schemas is only built again when they change
+	c.Check(p.known(), DeepEquals, map[string]bool{"blog": true})
+	known := p.cache().known.Load()
+	p.known()
+	c.Check(p.cache().known.Load(), Equals, known)
+}
+
+func (s *MySuite) Test_Prefix_shared(c *C) {
+	query := "SELECT * FROM {{pf:blog}}.shared_cache_test"
+	c.Check(Prefix("z_test", query), Equals, "SELECT * FROM `z_test_blog`.shared_cache_test")
+	c.Check(Prefix("z_other", query), Equals, "SELECT * FROM `z_other_blog`.shared_cache_test")
+	cached, ok := sharedCache.templates.Load(query)
+	c.Assert(ok, Equals, true)
+	c.Check(sharedPrefixr("z_test").Template(query), Equals, cached)
+}
+
+var benchmarkQuery = "SELECT u.name, r.total FROM {{pf:blog}}.users u " +
+	"JOIN `{{pf:reporting}}`.reports r ON r.user_id = u.id " +
+	"JOIN {{pf:`blog`}}.comments c ON c.user_id = u.id " +
+	"WHERE u.created_at > ? AND c.body LIKE '%{{pf:blog}}%' ORDER BY r.total DESC LIMIT 10"
+
+func BenchmarkPrefix(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		Prefix("z_bench", benchmarkQuery)
+	}
+}
+
+func BenchmarkPrefixr_Prefix(b *testing.B) {
+	p := &Prefixr{PrefixString: "z_bench"}
+	for i := 0; i < b.N; i++ {
+		p.Prefix(benchmarkQuery)
+	}
+}
+
+func BenchmarkPrefixr_Prefix_parallel(b *testing.B) {
+	p := &Prefixr{PrefixString: "z_bench"}
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			p.Prefix(benchmarkQuery)
+		}
+	})
+}
+
+func BenchmarkTemplate_Render(b *testing.B) {
+	t := Compile(benchmarkQuery)
+	for i := 0; i < b.N; i++ {
+		t.Render("z_bench")
+	}
+}
+
+// the regular expression version Prefix used to be, for comparison
+func BenchmarkPrefix_regexp(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		regexpPrefix("z_bench", benchmarkQuery)
+	}
+}
+
+func regexpPrefix(prefix, query string) string {
+	format := "`%s_%s`"
+	if prefix == "" {
+		format = "`%s%s`"
+	}
+
+	r := regexp.MustCompile("{{pf:`.+?`}}")
+	prefixed := r.ReplaceAllStringFunc(query, func(match string) string {
+		return fmt.Sprintf(format, prefix, match[6:len(match)-3])
+	})
+
+	r = regexp.MustCompile("`{{pf:.+?}}`")
+	prefixed = r.ReplaceAllStringFunc(prefixed, func(match string) string {
+		return fmt.Sprintf(format, prefix, match[6:len(match)-3])
+	})
+
+	r = regexp.MustCompile("{{pf:.+?}}")
+	return r.ReplaceAllStringFunc(prefixed, func(match string) string {
+		return fmt.Sprintf(format, prefix, match[5:len(match)-2])
+	})
+}
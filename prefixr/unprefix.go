@@ -0,0 +1,75 @@
+package prefixr
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Unprefix turns prefixed schema names in text - an error message, a log line, a query - back into the
+// logical names. `my-prefix_blog`.users becomes `blog`.users, and 'my-prefix_blog' becomes 'blog'.
+func Unprefix(prefix, text string) string {
+	return sharedPrefixr(prefix).Unprefix(text)
+}
+
+// Unprefix turns prefixed schema names in text back into the logical names. If Schemas is set, only
+// those schemas are unprefixed.
+func (p *Prefixr) Unprefix(text string) string {
+	return p.unprefix(text, func(name string, quoted bool) string {
+		if quoted {
+			return quoteIdentifier(name)
+		}
+		return name
+	})
+}
+
+// UnprefixPlaceholders turns prefixed schema names in text back into placeholders -
+// `my-prefix_blog`.users becomes {{pf:blog}}.users. If Schemas is set, only those schemas are
+// unprefixed.
+func (p *Prefixr) UnprefixPlaceholders(text string) string {
+	return p.unprefix(text, func(name string, quoted bool) string {
+		return fmt.Sprintf("%s%s}}", placeholderStart, name)
+	})
+}
+
+// replaces the prefixed schema names in text
+// replacement: gets what goes in place of a schema name. quoted is true if it was in backticks.
+func (p *Prefixr) unprefix(text string, replacement func(name string, quoted bool) string) string {
+	if p.PrefixString == "" {
+		return text
+	}
+
+	known := p.known()
+	pattern := p.unprefixPattern()
+	return pattern.ReplaceAllStringFunc(text, func(match string) string {
+		groups := pattern.FindStringSubmatch(match)
+		before, open, name, close := groups[1], groups[2], groups[3], groups[4]
+		if len(known) > 0 && !known[name] {
+			return match
+		}
+
+		// a backtick on one side only isn't quoting the name
+		if open != close {
+			return before + open + replacement(name, false) + close
+		}
+		return before + replacement(name, open != "")
+	})
+}
+
+// a compiled pattern for prefixed schema names, and the prefix it was compiled for
+type unprefixPattern struct {
+	prefix  string
+	pattern *regexp.Regexp
+}
+
+// gets the pattern for prefixed schema names - it's compiled again only when the prefix changes
+func (p *Prefixr) unprefixPattern() *regexp.Regexp {
+	c := p.cache()
+	if cached, ok := c.pattern.Load().(*unprefixPattern); ok && cached.prefix == p.PrefixString {
+		return cached.pattern
+	}
+
+	// the character before the name keeps prefixes inside other names from matching
+	pattern := regexp.MustCompile("(^|[^0-9A-Za-z$_])(`?)" + regexp.QuoteMeta(p.PrefixString) + "_([0-9A-Za-z$_]+)(`?)")
+	c.pattern.Store(&unprefixPattern{prefix: p.PrefixString, pattern: pattern})
+	return pattern
+}
@@ -0,0 +1,34 @@
+package prefixr
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) Test_Unprefix(c *C) {
+	text := "Error 1146: Table 'z_host_1697000000_blog.users' doesn't exist in " +
+		"SELECT * FROM `z_host_1697000000_blog`.users JOIN z_host_1697000000_reporting.reports, `z_host_1697000000_blog_archive`.posts " +
+		"JOIN zz_host_1697000000_blog.users"
+
+	c.Check(Unprefix("z_host_1697000000", text), Equals, "Error 1146: Table 'blog.users' doesn't exist in "+
+		"SELECT * FROM `blog`.users JOIN reporting.reports, `blog_archive`.posts "+
+		"JOIN zz_host_1697000000_blog.users")
+
+	// only known schemas
+	p := &Prefixr{PrefixString: "z_host_1697000000", Schemas: []string{"blog", "reporting"}}
+	c.Check(p.Unprefix(text), Equals, "Error 1146: Table 'blog.users' doesn't exist in "+
+		"SELECT * FROM `blog`.users JOIN reporting.reports, `z_host_1697000000_blog_archive`.posts "+
+		"JOIN zz_host_1697000000_blog.users")
+
+	// back to placeholders - prefixing them again gets the original
+	query := "SELECT * FROM `z_host_1697000000_blog`.users JOIN z_host_1697000000_reporting.reports"
+	c.Check(p.UnprefixPlaceholders(query), Equals, "SELECT * FROM {{pf:blog}}.users JOIN {{pf:reporting}}.reports")
+	c.Check(p.Prefix(p.UnprefixPlaceholders(query)), Equals, "SELECT * FROM `z_host_1697000000_blog`.users JOIN `z_host_1697000000_reporting`.reports")
+
+	// the pattern is compiled once, and again if the prefix changes
+	c.Check(p.unprefixPattern(), Equals, p.unprefixPattern())
+	p.PrefixString = "z_other"
+	c.Check(p.Unprefix("`z_other_blog`.users"), Equals, "`blog`.users")
+
+	// no prefix, nothing to strip
+	c.Check(Unprefix("", "SELECT * FROM `blog`.users"), Equals, "SELECT * FROM `blog`.users")
+}
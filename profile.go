@@ -0,0 +1,87 @@
+package fixrupr
+
+import (
+	"fmt"
+	"sort"
+)
+
+// checks that every profile only lists declared schemas and data
+func (def *fixrDef) validateProfiles() (problems []string) {
+	for _, name := range def.profileNames() {
+		profile := def.profiles[name]
+
+		schemas := map[string]bool{}
+		for _, schema := range profile.schemas {
+			found := false
+			for _, s := range def.schemas {
+				found = found || s.name == schema
+			}
+			if !found {
+				problems = append(problems, fmt.Sprintf("profile %s lists schema %q, which is not declared", name, schema))
+			}
+			schemas[schema] = true
+		}
+
+		for _, d := range profile.data {
+			var data *fixrDataDef
+			for i := range def.data {
+				if def.data[i].name == d {
+					data = &def.data[i]
+				}
+			}
+
+			if data == nil {
+				problems = append(problems, fmt.Sprintf("profile %s lists data %q, which is not declared", name, d))
+			} else if len(profile.schemas) > 0 && !schemas[data.schema] {
+				problems = append(problems, fmt.Sprintf("profile %s lists data %q, but not its schema %q", name, d, data.schema))
+			}
+		}
+	}
+
+	return
+}
+
+// gets the subset of def a profile selects. the profile's data is loaded in the order it is declared in
+// the config, not the order the profile lists it, so the tables are always filled in the same order.
+func (def *fixrDef) profile(name string) (profileDef *fixrDef, err error) {
+	profile, ok := def.profiles[name]
+	if !ok {
+		err = fmt.Errorf("unknown profile %q", name)
+		return
+	}
+
+	profileDef = &fixrDef{profiles: def.profiles}
+
+	if len(profile.schemas) == 0 {
+		profileDef.schemas = def.schemas
+	} else {
+		for _, schema := range def.schemas {
+			for _, s := range profile.schemas {
+				if s == schema.name {
+					profileDef.schemas = append(profileDef.schemas, schema)
+					break
+				}
+			}
+		}
+	}
+
+	for _, data := range def.data {
+		for _, d := range profile.data {
+			if d == data.name {
+				profileDef.data = append(profileDef.data, data)
+				break
+			}
+		}
+	}
+
+	return
+}
+
+func (def *fixrDef) profileNames() []string {
+	names := []string{}
+	for name := range def.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,47 @@
+package fixrupr
+
+import (
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) Test_fixrDef_profile(c *C) {
+	conf := s.mock_fixrConf(c)
+	def, err := conf.load()
+	c.Assert(err, IsNil)
+	c.Assert(def.profiles, HasLen, 2)
+
+	minimal, err := def.profile("minimal")
+	c.Assert(err, IsNil)
+	c.Assert(minimal.schemas, HasLen, 1)
+	c.Check(minimal.schemas[0].name, Equals, "blog")
+	c.Assert(minimal.data, HasLen, 1)
+	c.Check(minimal.data[0].name, Equals, "blog.users")
+
+	// no schemas means all of them, and data keeps the config order
+	comments, err := def.profile("comments")
+	c.Assert(err, IsNil)
+	c.Assert(comments.schemas, HasLen, 2)
+	c.Assert(comments.data, HasLen, 2)
+	c.Check(comments.data[0].name, Equals, "blog.users")
+	c.Check(comments.data[1].name, Equals, "blog.comments.article2")
+
+	_, err = def.profile("full")
+	c.Check(err, ErrorMatches, "unknown profile \"full\"")
+}
+
+func (s *MySuite) Test_fixrDef_validateProfiles(c *C) {
+	conf := s.mock_fixrConf(c)
+	def, err := conf.load()
+	c.Assert(err, IsNil)
+	c.Check(def.validateProfiles(), HasLen, 0)
+
+	def.profiles["broken"] = fixrProfileDef{
+		schemas: []string{"blog", "billing"},
+		data:    []string{"blog.users", "blog.nope", "reporting.reports"},
+	}
+	c.Check(def.validateProfiles(), DeepEquals, []string{
+		`profile broken lists schema "billing", which is not declared`,
+		`profile broken lists data "blog.nope", which is not declared`,
+		`profile broken lists data "reporting.reports", but not its schema "reporting"`,
+	})
+}
@@ -0,0 +1,101 @@
+package fixrupr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the format used for time cells when none is given - mysql's datetime format
+const defaultTimeFormat = "2006-01-02 15:04:05"
+
+// evaluates a relative time expression against now. expressions look like
+//
+//	now
+//	now+2h
+//	-3d
+//	now-1w+12h30m
+//
+// supported units are ns, us, ms, s, m, h, d (days), w (weeks), mo (months), and y (years)
+func relativeTime(expr string, now time.Time) (t time.Time, err error) {
+	t = now
+	rest := strings.TrimSpace(expr)
+	rest = strings.TrimPrefix(rest, "now")
+
+	for rest != "" {
+		sign := 1
+		switch rest[0] {
+		case '+':
+		case '-':
+			sign = -1
+		default:
+			err = fmt.Errorf("invalid time expression %q: expected + or - before %q", expr, rest)
+			return
+		}
+		rest = rest[1:]
+
+		// a signed term can have several number/unit pairs - like "+1h30m"
+		terms := 0
+		for rest != "" && rest[0] != '+' && rest[0] != '-' {
+			i := 0
+			for i < len(rest) && rest[i] >= '0' && rest[i] <= '9' {
+				i++
+			}
+			if i == 0 {
+				err = fmt.Errorf("invalid time expression %q: expected a number before %q", expr, rest)
+				return
+			}
+
+			var n int
+			n, err = strconv.Atoi(rest[:i])
+			if err != nil {
+				err = fmt.Errorf("invalid time expression %q: %s", expr, err)
+				return
+			}
+			n *= sign
+			rest = rest[i:]
+
+			j := 0
+			for j < len(rest) && (rest[j] < '0' || rest[j] > '9') && rest[j] != '+' && rest[j] != '-' {
+				j++
+			}
+			unit := rest[:j]
+			rest = rest[j:]
+
+			switch unit {
+			case "y":
+				t = t.AddDate(n, 0, 0)
+			case "mo":
+				t = t.AddDate(0, n, 0)
+			case "w":
+				t = t.AddDate(0, 0, 7*n)
+			case "d":
+				t = t.AddDate(0, 0, n)
+			case "h":
+				t = t.Add(time.Duration(n) * time.Hour)
+			case "m":
+				t = t.Add(time.Duration(n) * time.Minute)
+			case "s":
+				t = t.Add(time.Duration(n) * time.Second)
+			case "ms":
+				t = t.Add(time.Duration(n) * time.Millisecond)
+			case "us":
+				t = t.Add(time.Duration(n) * time.Microsecond)
+			case "ns":
+				t = t.Add(time.Duration(n))
+			default:
+				err = fmt.Errorf("invalid time expression %q: unknown unit %q", expr, unit)
+				return
+			}
+			terms++
+		}
+
+		if terms == 0 {
+			err = fmt.Errorf("invalid time expression %q: expected a number after the sign", expr)
+			return
+		}
+	}
+
+	return
+}
@@ -0,0 +1,33 @@
+package fixrupr
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) Test_relativeTime(c *C) {
+	now := time.Date(2015, 3, 15, 12, 30, 0, 0, time.UTC)
+
+	cases := map[string]time.Time{
+		"":              now,
+		"now":           now,
+		"now+2h":        time.Date(2015, 3, 15, 14, 30, 0, 0, time.UTC),
+		"-3d":           time.Date(2015, 3, 12, 12, 30, 0, 0, time.UTC),
+		"now-1w+12h30m": time.Date(2015, 3, 9, 1, 0, 0, 0, time.UTC),
+		"+1mo":          time.Date(2015, 4, 15, 12, 30, 0, 0, time.UTC),
+		"-1y":           time.Date(2014, 3, 15, 12, 30, 0, 0, time.UTC),
+		"+90s-500ms":    time.Date(2015, 3, 15, 12, 31, 29, 500000000, time.UTC),
+	}
+
+	for expr, expected := range cases {
+		t, err := relativeTime(expr, now)
+		c.Check(err, IsNil, Commentf(expr))
+		c.Check(t.Equal(expected), Equals, true, Commentf("%s: %s", expr, t))
+	}
+
+	for _, expr := range []string{"3d", "now+", "now+d", "+3x", "yesterday"} {
+		_, err := relativeTime(expr, now)
+		c.Check(err, NotNil, Commentf(expr))
+	}
+}
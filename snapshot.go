@@ -0,0 +1,88 @@
+package fixrupr
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+// WithSnapshotUpdate sets whether Snapshot writes golden files instead of comparing with them. The
+// fixruprtest package sets it from the -fixrupr.update flag.
+func WithSnapshotUpdate(update bool) Option {
+	return func(f *Fixr) {
+		f.updateSnapshots = update
+	}
+}
+
+// Snapshot compares the rows in a table with a golden file, and fails the test with a row-level diff if
+// they don't match. Returns true if they match. The golden file is
+//
+//	testdata/<test name>.<schema>.<table>.yml
+//
+// relative to the working directory - the package directory when running go test. When snapshots are
+// being updated (see WithSnapshotUpdate), the table's rows are written to the golden file instead, in
+// the data file format.
+//
+// t: the test
+// table: the logical table name - "<schema>.<table>"
+// opts (optional): IgnoreColumns, Unordered, OrderBy - ignored columns are left out of the golden file
+func (f *Fixr) Snapshot(t TB, table string, opts ...AssertOption) bool {
+	t.Helper()
+
+	options := &assertOptions{ignore: map[string]bool{}}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	file := filepath.Join("testdata", fmt.Sprintf("%s.%s.yml", filepath.FromSlash(t.Name()), table))
+
+	actual, err := f.selectRows(table, options.orderBy)
+	if err != nil {
+		t.Errorf("fixrupr: %s: %s", table, err)
+		return false
+	}
+
+	if f.updateSnapshots {
+		var content []byte
+		content, err = actual.marshalYAML(options.ignore)
+		if err == nil {
+			err = os.MkdirAll(filepath.Dir(file), 0755)
+		}
+		if err == nil {
+			err = ioutil.WriteFile(file, content, 0644)
+		}
+		if err != nil {
+			t.Errorf("fixrupr: %s: updating snapshot: %s", table, err)
+			return false
+		}
+		return true
+	}
+
+	content, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		t.Errorf("fixrupr: %s: no snapshot at %s - update snapshots to create it", table, file)
+		return false
+	}
+	if err != nil {
+		t.Errorf("fixrupr: %s: %s", table, err)
+		return false
+	}
+
+	// golden files hold values straight from the database - ${VAR}s in them aren't variables
+	expected := []map[string]fixrCellDef{}
+	err = yaml.Unmarshal(content, &expected)
+	if err != nil {
+		t.Errorf("fixrupr: %s: %s: %s", table, file, err)
+		return false
+	}
+
+	diff := f.diffRows(expected, actual, options)
+	if diff != "" {
+		t.Errorf("fixrupr: %s does not match %s\n%s", table, file, diff)
+		return false
+	}
+	return true
+}
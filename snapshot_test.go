@@ -0,0 +1,62 @@
+package fixrupr
+
+import (
+	"database/sql/driver"
+	"io/ioutil"
+	"os"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) Test_fixr_Snapshot(c *C) {
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(c.MkDir())
+
+	conn := &mockDb{
+		columns: []string{"id", "comment", "avatar", "posted"},
+		results: [][]driver.Value{
+			{[]byte("1"), []byte("cool!"), []byte{0, 255}, []byte("2015-03-15 12:30:00")},
+			{[]byte("2"), []byte("${not a variable}"), nil, nil},
+		},
+	}
+	fixr := &Fixr{conn: conn, prefix: "v_test"}
+	t := &mockTB{name: "TestComments/after_delete"}
+
+	// no snapshot yet
+	c.Check(fixr.Snapshot(t, "blog.comments"), Equals, false)
+	c.Assert(t.errors, HasLen, 1)
+	c.Check(t.errors[0], Equals, "fixrupr: blog.comments: no snapshot at testdata/TestComments/after_delete.blog.comments.yml - update snapshots to create it")
+
+	// update
+	t.errors = nil
+	fixr.updateSnapshots = true
+	c.Check(fixr.Snapshot(t, "blog.comments", IgnoreColumns("posted")), Equals, true)
+	c.Check(t.errors, HasLen, 0)
+
+	content, err := ioutil.ReadFile("testdata/TestComments/after_delete.blog.comments.yml")
+	c.Assert(err, IsNil)
+	c.Check(string(content), Equals, `- id: "1"
+  comment: cool!
+  avatar:
+    base64: AP8=
+- id: "2"
+  comment: ${not a variable}
+  avatar: null
+`)
+
+	// compare
+	fixr.updateSnapshots = false
+	c.Check(fixr.Snapshot(t, "blog.comments", IgnoreColumns("posted")), Equals, true)
+	c.Check(t.errors, HasLen, 0)
+
+	conn.results[1][1] = []byte("meh")
+	c.Check(fixr.Snapshot(t, "blog.comments", IgnoreColumns("posted")), Equals, false)
+	c.Assert(t.errors, HasLen, 1)
+	c.Check(t.errors[0], Equals, `fixrupr: blog.comments does not match testdata/TestComments/after_delete.blog.comments.yml
+  row 2 is different
+    - {id: "2", comment: "${not a variable}", avatar: NULL}
+    + {id: "2", comment: "meh", avatar: NULL}
+      comment: expected "${not a variable}", got "meh"
+`)
+}
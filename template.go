@@ -0,0 +1,447 @@
+package fixrupr
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/verkestk/fixrupr/prefixr"
+)
+
+// the table that marks a template as finished. it's created in the template's first schema after
+// everything else, so a template that's missing it was only partly built.
+const templateMarker = "_fixrupr_template"
+
+// how long a set up waits, in seconds, for another one to finish with the config's templates
+const templateLockTimeout = 300
+
+// the start of every template's schema names - followed by 8 characters of the config's hash and 16 of
+// the template's
+const templateNamePrefix = "z_tpl_"
+
+// WithTemplate makes SetUp (and SetUpProfile) copy the schemas from a template instead of running the
+// DDL every time. The template is a set of schemas built the first time it's needed, and named after a
+// hash of the DDL and data - so it's rebuilt automatically when the fixture files change.
+//
+// Tables are copied with "create table ... like" and their rows with "insert ... select", and their
+// foreign keys are added back afterwards. Views and functions are created from their DDL, since they
+// can't be copied. Data files with relative time cells or raw SQL cells are left out of the template and
+// inserted on every SetUp, so the times are always current. Templates for earlier versions of the config
+// are dropped when a new one is built.
+func WithTemplate() Option {
+	return func(f *Fixr) {
+		f.template = true
+	}
+}
+
+// the start of the names of this config's templates - a hash of where the config is, so templates that
+// other configs, or other copies of this one, are using are never mistaken for stale ones. it's also the
+// name of the lock the templates are built, copied, and dropped under.
+func (f *Fixr) templateConfig() string {
+	path, err := filepath.Abs(f.path)
+	if err != nil {
+		path = f.path
+	}
+	sum := sha256.Sum256([]byte(path))
+	return templateNamePrefix + hex.EncodeToString(sum[:])[0:8]
+}
+
+// the prefix of the template for the part of the config being set up
+func (f *Fixr) templatePrefix() string {
+	return f.templateConfig() + "_" + f.activeDef().hash()[0:16]
+}
+
+// creates the schemas by copying the template, building the template first if it doesn't exist yet
+func (f *Fixr) setUpFromTemplate() (err error) {
+	def := f.activeDef()
+	if len(def.schemas) == 0 {
+		return
+	}
+
+	// the template is set up like any other prefix, it just isn't tracked
+	copied := *f
+	template := &copied
+	template.def = def
+	template.active = def
+	template.prefix = f.templatePrefix()
+	template.schemaName = ""
+
+	static := def.staticTables()
+
+	// the lock is held while copying too, so the template can't be dropped halfway through the copy
+	err = f.lockTemplates(func() (err error) {
+		ready, err := template.templateReady()
+		if err != nil {
+			return
+		}
+		if !ready {
+			err = template.buildTemplate(static)
+			if err != nil {
+				return
+			}
+			err = f.dropStaleTemplates()
+			if err != nil {
+				return
+			}
+		}
+		return f.copyTemplate(template.prefix, static)
+	})
+	return
+}
+
+// checks whether the template was finished
+func (f *Fixr) templateReady() (ready bool, err error) {
+	query := "select count(*) from information_schema.tables where table_schema = ? and table_name = ?"
+	args := []interface{}{fmt.Sprintf("%s_%s", f.prefix, f.def.schemas[0].name), templateMarker}
+
+	rows, err := f.conn.Query(query, args...)
+	if err != nil {
+		err = newDbError(err, query, args)
+		return
+	}
+	defer rows.Close()
+
+	var count int
+	for rows.Next() {
+		err = rows.Scan(&count)
+		if err != nil {
+			err = newDbError(err, query, args)
+			return
+		}
+	}
+	err = rows.Err()
+	if err != nil {
+		err = newDbError(err, query, args)
+		return
+	}
+
+	ready = count > 0
+	return
+}
+
+// runs run while holding the lock on the config's templates, so set ups running at the same time - in
+// other processes too - take turns building, copying, and dropping them
+func (f *Fixr) lockTemplates(run func() error) (err error) {
+	// the lock belongs to the connection that took it
+	conn, release, err := f.session()
+	if err != nil {
+		return
+	}
+	defer release()
+
+	name := f.templateConfig()
+	query := "select get_lock(?, ?)"
+	args := []interface{}{name, templateLockTimeout}
+	rows, err := conn.Query(query, args...)
+	if err != nil {
+		err = newDbError(err, query, args)
+		return
+	}
+	var locked sql.NullInt64
+	for rows.Next() {
+		err = rows.Scan(&locked)
+		if err != nil {
+			rows.Close()
+			err = newDbError(err, query, args)
+			return
+		}
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		err = newDbError(err, query, args)
+		return
+	}
+	if locked.Int64 != 1 {
+		err = fmt.Errorf("timed out after %ds waiting for the lock on templates %s", templateLockTimeout, name)
+		return
+	}
+
+	defer func() {
+		query := "do release_lock(?)"
+		_, e := conn.Exec(query, name)
+		if e != nil && err == nil {
+			err = newDbError(e, query, []interface{}{name})
+		}
+	}()
+
+	return run()
+}
+
+// drops this config's templates that are for earlier versions of it - the ones that aren't for the whole
+// config or one of its profiles. other configs' templates are left alone. only call it while holding the
+// lock on the templates.
+func (f *Fixr) dropStaleTemplates() (err error) {
+	config := f.templateConfig() + "_"
+	current := map[string]bool{config + f.def.hash()[0:16]: true}
+	for _, name := range f.def.profileNames() {
+		profile, e := f.def.profile(name)
+		if e != nil {
+			return e
+		}
+		current[config+profile.hash()[0:16]] = true
+	}
+
+	query := "select schema_name from information_schema.schemata where schema_name like ?"
+	args := []interface{}{strings.Replace(config, "_", `\_`, -1) + "%"}
+	rows, err := f.conn.Query(query, args...)
+	if err != nil {
+		err = newDbError(err, query, args)
+		return
+	}
+	defer rows.Close()
+
+	stale := []string{}
+	for rows.Next() {
+		var name string
+		err = rows.Scan(&name)
+		if err != nil {
+			err = newDbError(err, query, args)
+			return
+		}
+		// like ignores case
+		if !strings.HasPrefix(name, config) {
+			continue
+		}
+		prefixLength := len(config) + 16
+		if len(name) <= prefixLength || !current[name[0:prefixLength]] {
+			stale = append(stale, name)
+		}
+	}
+	err = rows.Err()
+	if err != nil {
+		err = newDbError(err, query, args)
+		return
+	}
+
+	for _, name := range stale {
+		query = fmt.Sprintf("drop schema if exists `%s`", name)
+		_, err = f.conn.Exec(query)
+		if err != nil {
+			err = newDbError(err, query, []interface{}{})
+			return
+		}
+	}
+	return
+}
+
+// builds the template - creates the schemas and inserts the data that doesn't depend on the time
+// static: the tables whose data goes into the template
+func (f *Fixr) buildTemplate(static map[string]bool) (err error) {
+	// whatever's left from a build that didn't finish
+	for _, schema := range f.def.schemas {
+		query := fmt.Sprintf("drop schema if exists `%s_%s`", f.prefix, schema.name)
+		_, err = f.conn.Exec(query)
+		if err != nil {
+			err = newDbError(err, query, []interface{}{})
+			return
+		}
+	}
+
+	err = f.create()
+	if err != nil {
+		return
+	}
+
+	for _, d := range f.def.data {
+		if static[d.schema+"."+d.table] {
+			err = f.load(f.prefix, d)
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	query := fmt.Sprintf("create table `%s_%s`.`%s` (id int)", f.prefix, f.def.schemas[0].name, templateMarker)
+	_, err = f.conn.Exec(query)
+	if err != nil {
+		err = newDbError(err, query, []interface{}{})
+	}
+	return
+}
+
+// creates the schemas by copying the template's tables and rows
+// templatePrefix: the prefix of the template
+// static: the tables whose data is in the template
+func (f *Fixr) copyTemplate(templatePrefix string, static map[string]bool) (err error) {
+	def := f.activeDef()
+	for _, schema := range def.schemas {
+		err = f.schema(schema.name)
+		if err != nil {
+			return
+		}
+
+		for _, table := range schema.tables {
+			if isView(table.ddl) {
+				err = f.table(schema.name, table)
+			} else {
+				query := fmt.Sprintf("create table `%s_%s`.`%s` like `%s_%s`.`%s`", f.prefix, schema.name, table.name, templatePrefix, schema.name, table.name)
+				_, err = f.conn.Exec(query)
+				if err != nil {
+					err = newDbError(err, query, []interface{}{})
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+
+		for _, function := range schema.functions {
+			err = f.function(schema.name, function)
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	err = f.copyForeignKeys(templatePrefix)
+	if err != nil {
+		return
+	}
+
+	// rows go in in the same order as the data files, a whole table at a time
+	copied := map[string]bool{}
+	for _, d := range def.data {
+		table := d.schema + "." + d.table
+		if !static[table] {
+			err = f.load(f.prefix, d)
+			if err != nil {
+				return
+			}
+			continue
+		}
+		if copied[table] {
+			continue
+		}
+		copied[table] = true
+
+		query := fmt.Sprintf("insert into `%s_%s`.`%s` select * from `%s_%s`.`%s`", f.prefix, d.schema, d.table, templatePrefix, d.schema, d.table)
+		_, err = f.conn.Exec(query)
+		if err != nil {
+			err = newDbError(err, query, []interface{}{})
+			return
+		}
+	}
+
+	return
+}
+
+// checks whether ddl creates a view rather than a table - views can't be copied with create table ... like,
+// and don't have rows of their own
+func isView(ddl string) bool {
+	return prefixr.Compile(ddl).Creates() == "view"
+}
+
+// a foreign key on a template table
+type fixrForeignKey struct {
+	schema, table, name    string
+	columns                []string
+	referencedSchema       string
+	referencedTable        string
+	referencedColumns      []string
+	updateRule, deleteRule string
+}
+
+// adds the template tables' foreign keys to the copies - create table ... like leaves them out. keys
+// that reference a template schema reference the copy of it instead.
+// templatePrefix: the prefix of the template
+func (f *Fixr) copyForeignKeys(templatePrefix string) (err error) {
+	placeholders := []string{}
+	args := []interface{}{}
+	for _, schema := range f.activeDef().schemas {
+		placeholders = append(placeholders, "?")
+		args = append(args, fmt.Sprintf("%s_%s", templatePrefix, schema.name))
+	}
+	query := fmt.Sprintf("select k.table_schema, k.table_name, k.constraint_name, k.column_name, k.referenced_table_schema, k.referenced_table_name, "+
+		"k.referenced_column_name, r.update_rule, r.delete_rule from information_schema.key_column_usage k "+
+		"join information_schema.referential_constraints r on r.constraint_schema = k.constraint_schema and r.table_name = k.table_name and r.constraint_name = k.constraint_name "+
+		"where k.table_schema in (%s) and k.referenced_table_name is not null order by k.table_schema, k.table_name, k.constraint_name, k.ordinal_position",
+		strings.Join(placeholders, ", "))
+
+	rows, err := f.conn.Query(query, args...)
+	if err != nil {
+		err = newDbError(err, query, args)
+		return
+	}
+	defer rows.Close()
+
+	keys := []*fixrForeignKey{}
+	for rows.Next() {
+		var (
+			key                      fixrForeignKey
+			column, referencedColumn string
+		)
+		err = rows.Scan(&key.schema, &key.table, &key.name, &column, &key.referencedSchema, &key.referencedTable, &referencedColumn, &key.updateRule, &key.deleteRule)
+		if err != nil {
+			err = newDbError(err, query, args)
+			return
+		}
+
+		// a key with several columns has a row for each
+		last := len(keys) - 1
+		if last < 0 || keys[last].schema != key.schema || keys[last].table != key.table || keys[last].name != key.name {
+			keys = append(keys, &key)
+			last++
+		}
+		keys[last].columns = append(keys[last].columns, "`"+column+"`")
+		keys[last].referencedColumns = append(keys[last].referencedColumns, "`"+referencedColumn+"`")
+	}
+	err = rows.Err()
+	if err != nil {
+		err = newDbError(err, query, args)
+		return
+	}
+
+	// one alter table per table, so each table is only altered once
+	copyName := func(schema string) string {
+		if strings.HasPrefix(schema, templatePrefix+"_") {
+			return f.prefix + strings.TrimPrefix(schema, templatePrefix)
+		}
+		return schema
+	}
+	for i := 0; i < len(keys); {
+		clauses := []string{}
+		j := i
+		for ; j < len(keys) && keys[j].schema == keys[i].schema && keys[j].table == keys[i].table; j++ {
+			key := keys[j]
+			clauses = append(clauses, fmt.Sprintf("add constraint `%s` foreign key (%s) references `%s`.`%s` (%s) on update %s on delete %s",
+				key.name, strings.Join(key.columns, ", "), copyName(key.referencedSchema), key.referencedTable,
+				strings.Join(key.referencedColumns, ", "), key.updateRule, key.deleteRule))
+		}
+
+		query := fmt.Sprintf("alter table `%s`.`%s` %s", copyName(keys[i].schema), keys[i].table, strings.Join(clauses, ", "))
+		_, err = f.conn.Exec(query)
+		if err != nil {
+			err = newDbError(err, query, []interface{}{})
+			return
+		}
+		i = j
+	}
+	return
+}
+
+// the tables ("<schema>.<table>") whose data can go into a template - the ones without relative time
+// cells or raw SQL cells in any of their data files. those have to be evaluated when the rows go in.
+func (def *fixrDef) staticTables() map[string]bool {
+	static := map[string]bool{}
+	for _, d := range def.data {
+		static[d.schema+"."+d.table] = true
+	}
+
+	for _, d := range def.data {
+		if hasRawCells(d) {
+			static[d.schema+"."+d.table] = false
+		}
+		for _, row := range d.rows {
+			for _, cellDef := range row {
+				if cellDef.isTime {
+					static[d.schema+"."+d.table] = false
+				}
+			}
+		}
+	}
+	return static
+}
@@ -0,0 +1,164 @@
+package fixrupr
+
+import (
+	"database/sql/driver"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) mock_templateDef() *fixrDef {
+	return &fixrDef{
+		schemas: []fixrSchemaDef{
+			{
+				name: "blog",
+				tables: []fixrDDLDef{
+					{name: "users", ddl: "create table {{schema}}.users (id int)"},
+					{name: "comments", ddl: "create table {{schema}}.comments (id int, posted datetime)"},
+					{name: "recent", ddl: "CREATE ALGORITHM=MERGE VIEW {{schema}}.recent AS select * from {{schema}}.comments"},
+				},
+				functions: []fixrDDLDef{
+					{name: "greet", ddl: "create function {{schema}}.greet() returns int return 1"},
+				},
+			},
+		},
+		data: []fixrDataDef{
+			{name: "blog.users", schema: "blog", table: "users", rows: []map[string]fixrCellDef{
+				{"id": {notNil: true, value: "1"}},
+			}},
+			{name: "blog.comments", schema: "blog", table: "comments", rows: []map[string]fixrCellDef{
+				{"id": {notNil: true, value: "1"}, "posted": {notNil: true, isTime: true, timeExpr: "-1d", timeFormat: defaultTimeFormat}},
+			}},
+		},
+	}
+}
+
+// a clock for tests that always says 2015-03-15 12:30:00 UTC
+func (s *MySuite) mock_now() time.Time {
+	return time.Date(2015, 3, 15, 12, 30, 0, 0, time.UTC)
+}
+
+func (s *MySuite) Test_fixr_setUpFromTemplate(c *C) {
+	def := s.mock_templateDef()
+	def.data[0].rows[0]["id"] = fixrCellDef{notNil: true, isParameter: true, value: "1"}
+	fixr := &Fixr{def: def, path: "/fixtures/blog", prefix: "v_test", clock: s.mock_now, template: true}
+	config := fixr.templateConfig()
+	tpl := config + "_" + def.hash()[0:16]
+	c.Check(config, Matches, "z_tpl_[0-9a-f]{8}")
+
+	// no template yet - it gets built, then copied
+	conn := &mockDb{
+		columns: []string{"count(*)"},
+		results: [][]driver.Value{{int64(0)}},
+		foreignKeys: [][]driver.Value{
+			{[]byte(tpl + "_blog"), []byte("comments"), []byte("fk_other"), []byte("other_id"), []byte("shared"), []byte("others"), []byte("id"), []byte("NO ACTION"), []byte("SET NULL")},
+			{[]byte(tpl + "_blog"), []byte("comments"), []byte("fk_user"), []byte("user_id"), []byte(tpl + "_blog"), []byte("users"), []byte("id"), []byte("CASCADE"), []byte("RESTRICT")},
+			{[]byte(tpl + "_blog"), []byte("comments"), []byte("fk_user"), []byte("user_key"), []byte(tpl + "_blog"), []byte("users"), []byte("key"), []byte("CASCADE"), []byte("RESTRICT")},
+		},
+		schemata: [][]driver.Value{{[]byte(tpl + "_blog")}, {[]byte(config + "_0123456789abcdef_blog")}, {[]byte("z_tpl_00000000_0123456789abcdef_blog")}},
+	}
+	fixr.conn = conn
+
+	err := fixr.SetUp()
+	c.Assert(err, IsNil)
+	c.Assert(conn.queries, HasLen, 23)
+
+	// the template is checked, built and copied while holding the config's lock
+	c.Check(conn.queries[0], Equals, "select get_lock(?, ?)")
+	c.Check(conn.args[0], DeepEquals, []interface{}{config, templateLockTimeout})
+	c.Check(conn.queries[1], Equals, "select count(*) from information_schema.tables where table_schema = ? and table_name = ?")
+	c.Check(conn.args[1], DeepEquals, []interface{}{tpl + "_blog", "_fixrupr_template"})
+	c.Check(conn.queries[2], Equals, "drop schema if exists `"+tpl+"_blog`")
+	c.Check(conn.queries[3], Equals, "create schema `"+tpl+"_blog`")
+	c.Check(conn.queries[4], Equals, "create table "+tpl+"_blog.users (id int)")
+	c.Check(conn.queries[7], Equals, "create function "+tpl+"_blog.greet() returns int return 1")
+	c.Check(conn.queries[8], Matches, "select .* from information_schema.routines .*")
+	c.Check(conn.queries[9], Equals, "insert into `"+tpl+"_blog`.`users` (`id`) VALUES (?)")
+	c.Check(conn.queries[10], Equals, "create table `"+tpl+"_blog`.`_fixrupr_template` (id int)")
+
+	// this config's templates for other versions of it are dropped - other configs' are left alone
+	c.Check(conn.queries[11], Equals, "select schema_name from information_schema.schemata where schema_name like ?")
+	c.Check(conn.args[11], DeepEquals, []interface{}{strings.Replace(config, "_", `\_`, -1) + `\_%`})
+	c.Check(conn.queries[12], Equals, "drop schema if exists `"+config+"_0123456789abcdef_blog`")
+
+	c.Check(conn.queries[13], Equals, "create schema `v_test_blog`")
+	c.Check(conn.queries[14], Equals, "create table `v_test_blog`.`users` like `"+tpl+"_blog`.`users`")
+	c.Check(conn.queries[15], Equals, "create table `v_test_blog`.`comments` like `"+tpl+"_blog`.`comments`")
+	c.Check(conn.queries[16], Equals, "CREATE ALGORITHM=MERGE VIEW v_test_blog.recent AS select * from v_test_blog.comments")
+	c.Check(conn.queries[17], Equals, "create function v_test_blog.greet() returns int return 1")
+
+	// create table ... like leaves out the foreign keys - they're added back, pointing at the copies
+	c.Check(conn.queries[18], Matches, "select .* from information_schema.key_column_usage .*")
+	c.Check(conn.args[18], DeepEquals, []interface{}{tpl + "_blog"})
+	c.Check(conn.queries[19], Equals, "alter table `v_test_blog`.`comments` "+
+		"add constraint `fk_other` foreign key (`other_id`) references `shared`.`others` (`id`) on update NO ACTION on delete SET NULL, "+
+		"add constraint `fk_user` foreign key (`user_id`, `user_key`) references `v_test_blog`.`users` (`id`, `key`) on update CASCADE on delete RESTRICT")
+	c.Check(conn.queries[20], Equals, "insert into `v_test_blog`.`users` select * from `"+tpl+"_blog`.`users`")
+
+	// the time data isn't in the template - it's inserted fresh
+	c.Check(conn.queries[21], Equals, "insert into `v_test_blog`.`comments` (`id`,`posted`) VALUES (1,?)")
+	c.Check(conn.args[21], DeepEquals, []interface{}{"2015-03-14 12:30:00"})
+	c.Check(conn.queries[22], Equals, "do release_lock(?)")
+	c.Check(conn.args[22], DeepEquals, []interface{}{config})
+
+	// the template is ready - it's only copied
+	conn = &mockDb{columns: []string{"count(*)"}, results: [][]driver.Value{{int64(1)}}}
+	fixr.conn = conn
+	err = fixr.SetUp()
+	c.Assert(err, IsNil)
+	c.Assert(conn.queries, HasLen, 11)
+	c.Check(conn.queries[2], Equals, "create schema `v_test_blog`")
+	c.Check(conn.queries[10], Equals, "do release_lock(?)")
+
+	// another set up held the lock for too long
+	conn = &mockDb{columns: []string{"count(*)"}, results: [][]driver.Value{{int64(0)}}, locked: int64(0)}
+	fixr.conn = conn
+	err = fixr.SetUp()
+	c.Check(err, ErrorMatches, "timed out after 300s waiting for the lock on templates "+config)
+	c.Check(conn.queries, HasLen, 1)
+
+	// another copy of the config has its own templates
+	other := &Fixr{def: def, path: "/elsewhere/blog"}
+	c.Check(other.templateConfig(), Not(Equals), config)
+}
+
+func (s *MySuite) Test_fixrDef_staticTables(c *C) {
+	def := s.mock_templateDef()
+
+	// users has a raw cell, and comments a relative time
+	c.Check(def.staticTables(), DeepEquals, map[string]bool{"blog.users": false, "blog.comments": false})
+
+	def.data[0].rows[0]["id"] = fixrCellDef{notNil: true, isParameter: true, value: "1"}
+	c.Check(def.staticTables(), DeepEquals, map[string]bool{"blog.users": true, "blog.comments": false})
+}
+
+func (s *MySuite) Test_fixrDef_hash(c *C) {
+	def := s.mock_templateDef()
+	hash := def.hash()
+	ddlHash := def.ddlHash()
+	dataHash := def.dataHash()
+	c.Check(hash, HasLen, 64)
+	c.Check(s.mock_templateDef().hash(), Equals, hash)
+
+	// changing the data changes the data hash but not the ddl hash
+	def.data[0].rows[0]["id"] = fixrCellDef{notNil: true, value: "2"}
+	c.Check(def.ddlHash(), Equals, ddlHash)
+	c.Check(def.dataHash(), Not(Equals), dataHash)
+	c.Check(def.hash(), Not(Equals), hash)
+
+	def = s.mock_templateDef()
+	def.schemas[0].tables[0].ddl = "create table {{schema}}.users (id bigint)"
+	c.Check(def.ddlHash(), Not(Equals), ddlHash)
+	c.Check(def.dataHash(), Equals, dataHash)
+}
+
+func (s *MySuite) Test_isView(c *C) {
+	c.Check(isView("CREATE ALGORITHM=MERGE VIEW {{schema}}.recent AS select * from {{schema}}.comments"), Equals, true)
+	c.Check(isView("-- active users\ncreate view {{schema}}.active as select * from {{schema}}.users"), Equals, true)
+	c.Check(isView("/* v */ CREATE VIEW {{schema}}.active AS select 1"), Equals, true)
+
+	// a table named view is still a table
+	c.Check(isView("create table {{schema}}.`view` (id int)"), Equals, false)
+	c.Check(isView("create table {{schema}}.users (id int)"), Equals, false)
+}
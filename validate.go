@@ -0,0 +1,158 @@
+package fixrupr
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// validates the config - returns everything that's wrong with it, so it can all be reported at once
+// included: the schemas and tables from included configs, which data can also be for
+func (c *fixrConf) validate(included *fixrDef) (problems []string) {
+	problems = append(problems, c.problems...)
+
+	includedTables := map[string]map[string]bool{}
+	for _, schema := range included.schemas {
+		includedTables[schema.name] = map[string]bool{}
+		for _, table := range schema.tables {
+			includedTables[schema.name][table.name] = true
+		}
+	}
+
+	tables := map[string]map[string]bool{}
+	for i, schema := range c.Schemas {
+		if schema.Name == "" {
+			problems = append(problems, fmt.Sprintf("schemas[%d] has no name", i))
+			continue
+		}
+		if tables[schema.Name] != nil {
+			problems = append(problems, fmt.Sprintf("schema %q is declared more than once", schema.Name))
+			continue
+		}
+
+		tables[schema.Name] = map[string]bool{}
+		for _, table := range schema.Tables {
+			if tables[schema.Name][table] {
+				problems = append(problems, fmt.Sprintf("table %q is declared more than once in schema %q", table, schema.Name))
+			}
+			tables[schema.Name][table] = true
+		}
+	}
+
+	for _, d := range c.Data {
+		pieces := strings.Split(d, ".")
+		if len(pieces) < 2 || pieces[0] == "" || pieces[1] == "" {
+			problems = append(problems, fmt.Sprintf("data %q must be named <schema>.<table>[.<anything>]", d))
+		} else if tables[pieces[0]] == nil && includedTables[pieces[0]] == nil {
+			problems = append(problems, fmt.Sprintf("data %q is for schema %q, which is not declared", d, pieces[0]))
+		} else if !tables[pieces[0]][pieces[1]] && !includedTables[pieces[0]][pieces[1]] {
+			problems = append(problems, fmt.Sprintf("data %q is for table %q, which is not declared in schema %q", d, pieces[1], pieces[0]))
+		}
+	}
+
+	return
+}
+
+// finds the fields in a decoded config that don't match a json tag in the config struct
+// value: the decoded config (or part of it)
+// t: the type value is decoded into
+// path: where value is in the config - used in the problem descriptions
+func unknownFields(value interface{}, t reflect.Type, path string) (problems []string) {
+	switch t.Kind() {
+	case reflect.Ptr:
+		problems = unknownFields(value, t.Elem(), path)
+
+	case reflect.Struct:
+		// type mismatches are left for json.Unmarshal to report
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return
+		}
+
+		fields := map[string]reflect.Type{}
+		for i := 0; i < t.NumField(); i++ {
+			tag := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+			if tag != "" && tag != "-" {
+				fields[tag] = t.Field(i).Type
+			}
+		}
+
+		for _, key := range sortedKeys(m) {
+			fieldType, ok := fields[key]
+			if !ok {
+				where := path
+				if where == "" {
+					where = "the top level"
+				}
+				problems = append(problems, fmt.Sprintf("unknown field %q in %s", key, where))
+				continue
+			}
+			problems = append(problems, unknownFields(m[key], fieldType, joinPath(path, key))...)
+		}
+
+	case reflect.Slice:
+		l, ok := value.([]interface{})
+		if !ok {
+			return
+		}
+		for i, v := range l {
+			problems = append(problems, unknownFields(v, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+
+	case reflect.Map:
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return
+		}
+		for _, key := range sortedKeys(m) {
+			problems = append(problems, unknownFields(m[key], t.Elem(), joinPath(path, key))...)
+		}
+	}
+
+	return
+}
+
+// converts decoded yaml and toml configs into the same shape json decodes into - yaml gives
+// map[interface{}]interface{} and toml gives []map[string]interface{} for arrays of tables
+func normalizeConfig(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for key, val := range v {
+			m[fmt.Sprint(key)] = normalizeConfig(val)
+		}
+		return m
+	case map[string]interface{}:
+		for key, val := range v {
+			v[key] = normalizeConfig(val)
+		}
+	case []map[string]interface{}:
+		l := []interface{}{}
+		for _, val := range v {
+			l = append(l, normalizeConfig(val))
+		}
+		return l
+	case []interface{}:
+		for i, val := range v {
+			v[i] = normalizeConfig(val)
+		}
+	}
+	return value
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return fmt.Sprintf("%s.%s", path, key)
+}
@@ -0,0 +1,121 @@
+package fixrupr
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	. "gopkg.in/check.v1"
+)
+
+var (
+	configYAML = `
+schemas:
+  - name: blog
+    tables: [users, articles, comments]
+    functions: [copy_article]
+  - name: reporting
+    tables: [reports]
+data:
+  - blog.users
+  - blog.articles
+  - blog.comments.article1
+  - blog.comments.article2
+  - reporting.reports
+`
+
+	configTOML = `
+data = ["blog.users", "blog.articles", "blog.comments.article1", "blog.comments.article2", "reporting.reports"]
+
+[[schemas]]
+name = "blog"
+tables = ["users", "articles", "comments"]
+functions = ["copy_article"]
+
+[[schemas]]
+name = "reporting"
+tables = ["reports"]
+`
+)
+
+func (s *MySuite) Test_findConfig(c *C) {
+	dir := c.MkDir()
+
+	_, err := findConfig(dir)
+	c.Check(err, ErrorMatches, "no config file in .*")
+
+	ioutil.WriteFile(fmt.Sprintf("%s/test.config.yml", dir), []byte(configYAML), 0755)
+	filename, err := findConfig(dir)
+	c.Check(err, IsNil)
+	c.Check(filename, Equals, fmt.Sprintf("%s/test.config.yml", dir))
+
+	ioutil.WriteFile(fmt.Sprintf("%s/test.config.toml", dir), []byte(configTOML), 0755)
+	_, err = findConfig(dir)
+	c.Check(err, ErrorMatches, "more than one config file in .*: test.config.yml, test.config.toml")
+}
+
+func (s *MySuite) Test_loadConfig_formats(c *C) {
+	dir := s.help_mockFiles(c)
+	ioutil.WriteFile(fmt.Sprintf("%s/test.config.yaml", dir), []byte(configYAML), 0755)
+	ioutil.WriteFile(fmt.Sprintf("%s/test.config.toml", dir), []byte(configTOML), 0755)
+
+	for _, name := range []string{"test.config.json", "test.config.yaml", "test.config.toml"} {
+		conf, err := loadConfig(fmt.Sprintf("%s/%s", dir, name))
+		c.Assert(err, IsNil, Commentf(name))
+		conf.path = dir
+
+		c.Check(conf.file, Equals, name)
+		c.Check(conf.problems, HasLen, 0)
+		c.Assert(conf.Schemas, HasLen, 2, Commentf(name))
+		c.Check(conf.Schemas[0].Name, Equals, "blog")
+		c.Check(conf.Schemas[0].Tables, DeepEquals, []string{"users", "articles", "comments"})
+		c.Check(conf.Schemas[0].Functions, DeepEquals, []string{"copy_article"})
+		c.Check(conf.Schemas[1].Name, Equals, "reporting")
+		c.Check(conf.Schemas[1].Tables, DeepEquals, []string{"reports"})
+		c.Check(conf.Data, HasLen, 5)
+
+		def, err := conf.load()
+		c.Check(err, IsNil, Commentf(name))
+		c.Check(def.data, HasLen, 5)
+	}
+}
+
+func (s *MySuite) Test_fixrConf_validate(c *C) {
+	dir := c.MkDir()
+	ioutil.WriteFile(fmt.Sprintf("%s/test.config.yml", dir), []byte(`
+schemas:
+  - name: blog
+    tables: [users, users]
+    fuctions: [copy_article]
+  - name: blog
+  - tables: [reports]
+datta: []
+data:
+  - users
+  - blog.users
+  - blog.articles
+  - reporting.reports
+`), 0755)
+
+	conf, err := loadConfig(fmt.Sprintf("%s/test.config.yml", dir))
+	c.Assert(err, IsNil)
+	c.Check(conf.problems, DeepEquals, []string{
+		`unknown field "datta" in the top level`,
+		`unknown field "fuctions" in schemas[0]`,
+	})
+
+	c.Check(conf.validate(&fixrDef{}), DeepEquals, []string{
+		`unknown field "datta" in the top level`,
+		`unknown field "fuctions" in schemas[0]`,
+		`table "users" is declared more than once in schema "blog"`,
+		`schema "blog" is declared more than once`,
+		`schemas[2] has no name`,
+		`data "users" must be named <schema>.<table>[.<anything>]`,
+		`data "blog.articles" is for table "articles", which is not declared in schema "blog"`,
+		`data "reporting.reports" is for schema "reporting", which is not declared`,
+	})
+
+	// load reports the problems before it tries to read any files
+	conf.path = dir
+	_, err = conf.load()
+	c.Check(err, FitsTypeOf, &confError{})
+}
@@ -0,0 +1,115 @@
+package fixrupr
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// matches ${VAR} references, and $${VAR} escapes - bare $VAR is left alone so things like $$ in function
+// bodies still work
+var varPattern = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expands ${VAR} references in s. vars take precedence over the environment. $${VAR} is written out as
+// a literal ${VAR}.
+// source: where s came from - used in the error message if there are unknown variables
+func expandVars(s string, vars map[string]string, source string) (expanded string, err error) {
+	unknown := []string{}
+	expanded = varPattern.ReplaceAllStringFunc(s, func(match string) string {
+		if strings.HasPrefix(match, "$$") {
+			return match[1:]
+		}
+		name := match[2 : len(match)-1]
+		if value, ok := lookupVar(name, vars); ok {
+			return value
+		}
+		unknown = append(unknown, name)
+		return match
+	})
+
+	if len(unknown) > 0 {
+		err = fmt.Errorf("unknown variable(s) %s in %s", strings.Join(unknown, ", "), source)
+	}
+	return
+}
+
+// gets a variable - from vars if it's there, otherwise from the environment
+func lookupVar(name string, vars map[string]string) (string, bool) {
+	if value, ok := vars[name]; ok {
+		return value, true
+	}
+	return os.LookupEnv(name)
+}
+
+// expands the variables in the config's includes, and its schema, table, function, data, and profile
+// names. unknown variables are added to the config's problems, so they're reported along with everything
+// else.
+func (c *fixrConf) expand() {
+	expand := func(s string, source string) string {
+		expanded, err := expandVars(s, c.vars, source)
+		if err != nil {
+			c.problems = append(c.problems, err.Error())
+		}
+		return expanded
+	}
+
+	// an include with an unknown variable can't be found, so it's left out - the problem says why
+	includes := []string{}
+	for _, include := range c.Include {
+		expanded, err := expandVars(include, c.vars, "include")
+		if err != nil {
+			c.problems = append(c.problems, err.Error())
+			continue
+		}
+		includes = append(includes, expanded)
+	}
+	c.Include = includes
+
+	for i := range c.Schemas {
+		schema := &c.Schemas[i]
+		schema.Name = expand(schema.Name, "schema name")
+		for j := range schema.Tables {
+			schema.Tables[j] = expand(schema.Tables[j], fmt.Sprintf("schema %s tables", schema.Name))
+		}
+		for j := range schema.Functions {
+			schema.Functions[j] = expand(schema.Functions[j], fmt.Sprintf("schema %s functions", schema.Name))
+		}
+	}
+
+	for i := range c.Data {
+		c.Data[i] = expand(c.Data[i], "data")
+	}
+
+	for name, profile := range c.Profiles {
+		for i := range profile.Schemas {
+			profile.Schemas[i] = expand(profile.Schemas[i], fmt.Sprintf("profile %s schemas", name))
+		}
+		for i := range profile.Data {
+			profile.Data[i] = expand(profile.Data[i], fmt.Sprintf("profile %s data", name))
+		}
+	}
+}
+
+// expands the variables in the values, columns, and file paths of data cells
+func (c *fixrConf) expandRows(rows []map[string]fixrCellDef, source string) (err error) {
+	for _, row := range rows {
+		for field, cellDef := range row {
+			cellDef.value, err = expandVars(cellDef.value, c.vars, source)
+			if err != nil {
+				return
+			}
+			cellDef.column, err = expandVars(cellDef.column, c.vars, source)
+			if err != nil {
+				return
+			}
+			cellDef.file, err = expandVars(cellDef.file, c.vars, source)
+			if err != nil {
+				return
+			}
+			row[field] = cellDef
+		}
+	}
+
+	return
+}
@@ -0,0 +1,130 @@
+package fixrupr
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *MySuite) Test_expandVars(c *C) {
+	os.Setenv("FIXRUPR_TEST_ENGINE", "MyISAM")
+	defer os.Unsetenv("FIXRUPR_TEST_ENGINE")
+
+	vars := map[string]string{"CHARSET": "utf8mb4", "FIXRUPR_TEST_ENGINE": "InnoDB"}
+
+	expanded, err := expandVars("ENGINE=${FIXRUPR_TEST_ENGINE} CHARSET=${CHARSET} $$ $CHARSET", vars, "users.sql")
+	c.Check(err, IsNil)
+	c.Check(expanded, Equals, "ENGINE=InnoDB CHARSET=utf8mb4 $$ $CHARSET")
+
+	expanded, err = expandVars("ENGINE=${FIXRUPR_TEST_ENGINE}", nil, "users.sql")
+	c.Check(err, IsNil)
+	c.Check(expanded, Equals, "ENGINE=MyISAM")
+
+	// $${VAR} is a literal ${VAR}
+	expanded, err = expandVars("SET @x = '$${FIXRUPR_TEST_NOPE}', @y = '$$${CHARSET}'", vars, "users.sql")
+	c.Check(err, IsNil)
+	c.Check(expanded, Equals, "SET @x = '${FIXRUPR_TEST_NOPE}', @y = '$${CHARSET}'")
+
+	_, err = expandVars("${FIXRUPR_TEST_NOPE} ${CHARSET} ${FIXRUPR_TEST_NADA}", vars, "users.sql")
+	c.Check(err, ErrorMatches, "unknown variable\\(s\\) FIXRUPR_TEST_NOPE, FIXRUPR_TEST_NADA in users.sql")
+}
+
+func (s *MySuite) Test_fixrConf_load_vars(c *C) {
+	dir := s.help_mockFiles(c)
+	ioutil.WriteFile(fmt.Sprintf("%s/test.config.json", dir), []byte(`{
+  "schemas": [{
+    "name": "blog",
+    "tables": ["${TABLE}"]
+  }],
+  "data": ["blog.${TABLE}"]
+}`), 0755)
+	ioutil.WriteFile(fmt.Sprintf("%s/schema/blog/tables/users.sql", dir), []byte("create table users () ENGINE=${ENGINE}"), 0755)
+	ioutil.WriteFile(fmt.Sprintf("%s/data/blog.users.yml", dir), []byte(`
+- id: 1
+  tenant: ${TENANT}
+  name:
+    column: ${TENANT}_name
+    value: maya
+`), 0755)
+
+	conf, err := loadConfig(fmt.Sprintf("%s/test.config.json", dir))
+	c.Assert(err, IsNil)
+	conf.path = dir
+	conf.vars = map[string]string{"TABLE": "users", "ENGINE": "InnoDB", "TENANT": "acme"}
+
+	def, err := conf.load()
+	c.Assert(err, IsNil)
+	c.Assert(def.schemas, HasLen, 1)
+	c.Assert(def.schemas[0].tables, HasLen, 1)
+	c.Check(def.schemas[0].tables[0].ddl, Equals, "create table users () ENGINE=InnoDB")
+	c.Assert(def.data, HasLen, 1)
+	c.Check(def.data[0].table, Equals, "users")
+	c.Assert(def.data[0].rows, HasLen, 1)
+	c.Check(def.data[0].rows[0]["tenant"].value, Equals, "acme")
+	c.Check(def.data[0].rows[0]["name"].column, Equals, "acme_name")
+
+	conf, err = loadConfig(fmt.Sprintf("%s/test.config.json", dir))
+	c.Assert(err, IsNil)
+	conf.path = dir
+	conf.vars = map[string]string{"TABLE": "users", "TENANT": "acme"}
+
+	_, err = conf.load()
+	c.Check(err, ErrorMatches, "unknown variable\\(s\\) ENGINE in .*/schema/blog/tables/users.sql")
+}
+
+func (s *MySuite) Test_fixrConf_load_unknownVars(c *C) {
+	dir := s.help_mockFiles(c)
+	ioutil.WriteFile(fmt.Sprintf("%s/test.config.json", dir), []byte(`{
+  "schemas": [{
+    "name": "blog",
+    "tables": ["${FIXRUPR_TEST_TABLE}"]
+  }],
+  "data": ["blog.users", "blog.${FIXRUPR_TEST_DATA}", "nope.users"]
+}`), 0755)
+
+	conf, err := loadConfig(fmt.Sprintf("%s/test.config.json", dir))
+	c.Assert(err, IsNil)
+	conf.path = dir
+
+	// every problem at once - the unknown variables and the rest of the validation
+	_, err = conf.load()
+	c.Check(err, ErrorMatches, "(?s)invalid config .*:\n"+
+		"  unknown variable\\(s\\) FIXRUPR_TEST_TABLE in schema blog tables\n"+
+		"  unknown variable\\(s\\) FIXRUPR_TEST_DATA in data\n"+
+		"  data \"blog.users\" is for table \"users\", which is not declared in schema \"blog\"\n"+
+		"  .*")
+}
+
+func (s *MySuite) Test_fixrConf_load_includeVars(c *C) {
+	root := c.MkDir()
+	files := map[string]string{
+		"shared/test.config.yml":                  "schemas:\n  - name: accounts\n    tables: [users]\n",
+		"shared/schema/accounts/tables/users.sql": "create users",
+		"service/test.config.yml":                 "include: [\"${FIXRUPR_TEST_SHARED}\"]\n",
+	}
+	for name, content := range files {
+		os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0755)
+		ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0755)
+	}
+
+	conf, err := loadConfig(filepath.Join(root, "service/test.config.yml"))
+	c.Assert(err, IsNil)
+	conf.path = filepath.Join(root, "service")
+	conf.vars = map[string]string{"FIXRUPR_TEST_SHARED": "../shared"}
+
+	def, err := conf.load()
+	c.Assert(err, IsNil)
+	c.Assert(def.schemas, HasLen, 1)
+	c.Check(def.schemas[0].name, Equals, "accounts")
+
+	// an unknown variable is a config problem, not a missing directory
+	conf, err = loadConfig(filepath.Join(root, "service/test.config.yml"))
+	c.Assert(err, IsNil)
+	conf.path = filepath.Join(root, "service")
+
+	_, err = conf.load()
+	c.Check(err, ErrorMatches, "invalid config test.config.yml:\n  unknown variable\\(s\\) FIXRUPR_TEST_SHARED in include")
+}